@@ -33,10 +33,16 @@ var embeddedDefs embed.FS
 //go:embed ghkey.txt
 var githubApiKey string
 
+// minisign public key trusted for self-update (release archives must be signed with matching secret key)
+//
+//go:embed nomad.pub
+var nomadPublicKey string
+
 func main() {
 	os.Exit(cli.Main(
 		embeddedDefs,
 		githubApiKey,
+		nomadPublicKey,
 		version,
 		fmt.Sprint(" [", buildDate, "]", " (", commit, ")"),
 	))
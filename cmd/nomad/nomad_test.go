@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/gologme/log"
 	"github.com/gookit/goutil/testutil/assert"
 	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
@@ -48,7 +49,7 @@ func checkDownloadableAsset(t *testing.T, def *data.AppDefinition) {
 	defVersion, _ := version2.FromString(def.Version)
 	downloadURL := defVersion.FillVersionsPlaceholders(def.DownloadUrl)
 
-	client, err := helper.BuildAndDoHttp(downloadURL, "HEAD", def.SslIgnoreBadCert)
+	client, err := helper.BuildAndDoHttp(context.Background(), downloadURL, "HEAD", def.SslIgnoreBadCert)
 
 	if assert.NoError(t, err, "http client error url "+downloadURL) &&
 		assert.NotNil(t, client, "app", def.ApplicationName, " failed : ", "http client for url "+downloadURL+" should not be nil") {
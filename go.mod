@@ -1,30 +1,47 @@
 module github.com/jonathanMelly/nomad
 
-go 1.20
+go 1.22
 
 require (
+	aead.dev/minisign v0.2.0
+	github.com/ProtonMail/go-crypto v1.1.6
+	github.com/bodgit/sevenzip v1.6.0
 	github.com/briandowns/spinner v1.23.0
+	github.com/gofrs/flock v0.12.1
 	github.com/gologme/log v1.3.0
 	github.com/gookit/config/v2 v2.2.1
 	github.com/gookit/goutil v0.6.6
+	github.com/klauspost/compress v1.18.0
 	github.com/nyaosorg/go-windows-junction v0.1.0
 	github.com/udhos/equalfile v0.3.0
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/crypto v0.17.0
 	golang.org/x/exp v0.0.0-20220909182711-5c715a9e8561
+	golang.org/x/term v0.15.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/BurntSushi/toml v1.2.1 // indirect
 	github.com/Microsoft/go-winio v0.5.2 // indirect
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/bodgit/plumbing v1.3.0 // indirect
+	github.com/bodgit/windows v1.0.1 // indirect
+	github.com/cloudflare/circl v1.3.7 // indirect
 	github.com/fatih/color v1.14.1 // indirect
 	github.com/goccy/go-json v0.10.0 // indirect
 	github.com/gookit/color v1.5.2 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
 	github.com/imdario/mergo v0.3.13 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.17 // indirect
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
-	golang.org/x/sync v0.1.0 // indirect
-	golang.org/x/sys v0.5.0 // indirect
-	golang.org/x/term v0.5.0 // indirect
-	golang.org/x/text v0.7.0 // indirect
+	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
+	golang.org/x/sync v0.9.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	golang.org/x/text v0.20.0 // indirect
 )
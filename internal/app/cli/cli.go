@@ -1,29 +1,41 @@
 package cli
 
 import (
+	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/gologme/log"
 	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
 	"github.com/jonathanMelly/nomad/internal/pkg/helper"
 	"github.com/jonathanMelly/nomad/internal/pkg/installer"
 	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"github.com/jonathanMelly/nomad/pkg/bytesize"
 	versionLib "github.com/jonathanMelly/nomad/pkg/version"
 	"golang.org/x/exp/slices"
 	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
 )
 
 var versionString string
 var versionAdditionalInfos string
 
-func setupBaseConfigAndSettings(githubPat string, versionString string, archivesSubdir string) {
+func setupBaseConfigAndSettings(githubPat string, nomadPublicKey string, versionString string, archivesSubdir string) {
 	version, _ := versionLib.FromString(versionString)
 
 	configuration.Version = version
+	configuration.NomadPublicKey = strings.TrimSpace(nomadPublicKey)
 	configuration.Settings.GithubApiKey = githubPat
 	configuration.Settings.ArchivesDirectory = archivesSubdir
 }
@@ -33,14 +45,26 @@ var exeName = filepath.Base(os.Args[0])
 func customUsage() {
 
 	printVersion()
-	fmt.Printf("Main usage: %s install|update|status [OPTIONS] [...appName]\n\nOPTIONS:\n", exeName)
+	fmt.Printf("Main usage: %s install|update|status|uninstall|sync|lock|use|rollback|prune|doctor|recover [OPTIONS] [...appName]\n\nOPTIONS:\n", exeName)
 	flag.PrintDefaults()
 	fmt.Println("\nExamples:")
 	fmt.Println("\t", exeName, "i[nstall] rclone")
 	fmt.Println("\t", exeName, "u[pgrade] rclone")
 	fmt.Println("\t", exeName, "st[atus]")
-	fmt.Println("\t", exeName, "-confirm=false install filezilla")
+	fmt.Println("\t", exeName, "sy[nc]")
+	fmt.Println("\t", exeName, "lo[ck]")
+	fmt.Println("\t", exeName, "-frozen i[nstall]")
+	fmt.Println("\t", exeName, "-output=json st[atus]")
+	fmt.Println("\t", exeName, "-yes install filezilla")
+	fmt.Println("\t", exeName, "-dry-run u[pgrade]")
 	fmt.Println("\t", exeName, "-verbose u[pdate] git obs")
+	fmt.Println("\t", exeName, "un[install] filezilla")
+	fmt.Println("\t", exeName, "-purge un[install] filezilla")
+	fmt.Println("\t", exeName, "use rclone 1.62.2")
+	fmt.Println("\t", exeName, "ro[llback] rclone")
+	fmt.Println("\t", exeName, "-dry-run p[rune]")
+	fmt.Println("\t", exeName, "-fix d[octor]")
+	fmt.Println("\t", exeName, "rec[over]")
 	fmt.Println("\t", exeName, "v[ersion]")
 	fmt.Println("\nList available apps for install:")
 	fmt.Println("\t", exeName, "l[ist]")
@@ -51,6 +75,9 @@ func printVersion() {
 	if err != nil {
 		log.Errorln(err)
 	}
+	if configuration.NomadPublicKey == "" {
+		log.Warnln("No trusted key embedded in this build, self update is disabled")
+	}
 }
 
 //goland:noinspection GoSnakeCaseUsage
@@ -62,9 +89,14 @@ const (
 
 	EXIT_UNKNOWN_ACTION = 67
 	EXIT_NO_VALID_APP   = 68
+	EXIT_OUTPUT_ERROR   = 69
+
+	EXIT_HEALTH_PROBLEMS = 70
+	EXIT_PARTIAL_FAILURE = 71 //some apps failed (see summary)
+	EXIT_BUSY            = 72 //apps directory used by another nomad process (see -wait)
 )
 
-func Main(_embeddedDefs embed.FS, _githubPat string, _version string, _versionExtras string) int {
+func Main(_embeddedDefs embed.FS, _githubPat string, _nomadPublicKey string, _version string, _versionExtras string) int {
 	versionString = _version //must be done for customUsage
 	versionAdditionalInfos = _versionExtras
 	flag.Usage = customUsage
@@ -77,14 +109,30 @@ func Main(_embeddedDefs embed.FS, _githubPat string, _version string, _versionEx
 	flagSkipDownload := flag.Bool("skip", true, "Skip download if corresponding archive is already present")
 	flagLatestVersion := flag.Bool("latest", true, "If version URL is set, check and use latest version available")
 	flagOptimist := flag.Bool("optimist", true, "If true and multiple config given, continue after one failed")
-	flagConfirm := flag.Bool("confirm", true, "Asks user to confirm operation")
+	flagConfirm := flag.Bool("confirm", true, "Asks user to confirm operation (once, after showing the plan)")
+	flagYes := flag.Bool("yes", false, "Assume yes to all questions (unattended run, same as -confirm=false)")
 	flagArchivesSubDir := flag.String("archives", "archives", "Set archives sub dir")
 	flagVerbose := flag.Bool("verbose", false, "Verbose mode (mainly for debug)")
 	flagVeryVerbose := flag.Bool("vverbose", false, "Very verbose mode (debug)")
 	flagRefresh := flag.Bool("refresh", false, "Try to redo files operations, symlinks and shortcuts even with no version bump")
+	flagPurge := flag.Bool("purge", false, "When uninstalling, also remove downloaded archives")
+	flagBackup := flag.Bool("backup", true, "When uninstalling, keep RestoreFiles data in a backup folder")
+	flagStrict := flag.Bool("strict", false, "When syncing, uninstall installed apps missing from myapps")
+	flagRestore := flag.Bool("restore", false, "When switching version (use/rollback), restore RestoreFiles from the version being left")
+	flagFix := flag.Bool("fix", false, "When running doctor, apply safe repairs (dangling links, orphan shortcuts...)")
+	flagFrozen := flag.Bool("frozen", false, "Install exactly what nomad.lock pins (no remote version check, fails on hash mismatch)")
+	flagDryRun := flag.Bool("dry-run", false, "Only show the plan (install/upgrade/sync/uninstall/prune), change nothing")
+	flagOutput := flag.String("output", OUTPUT_LOG, "Print status/list/results to stdout as json|yaml|table|template (logs stay on stderr)")
+	flagJobs := flag.Int("jobs", 1, "Number of apps installed/upgraded at once (with more than 1, logs of each app are grouped)")
+	flagWait := flag.Duration("wait", 0, "If another nomad process is changing apps directory, wait up to this duration (example: 5m) instead of failing")
+	flagTemplate := flag.String("template", "", "Go template applied to each record when -output=template (example: '{{.App}} {{.Status}}')")
 
 	flag.Parse()
 
+	if *flagYes {
+		*flagConfirm = false
+	}
+
 	/*
 	   Level 10 = panic, fatal, error, warn, info, debug, & trace
 	   Level 5 = panic, fatal, error, warn, info, & debug
@@ -108,8 +156,11 @@ func Main(_embeddedDefs embed.FS, _githubPat string, _version string, _versionEx
 	if len(flag.Args()) < 1 {
 		flag.Usage()
 		os.Exit(EXIT_BAD_USAGE)
+	} else if err := validateOutputFormat(*flagOutput, *flagTemplate); err != nil {
+		log.Errorln(err)
+		return EXIT_BAD_USAGE
 	} else {
-		setupBaseConfigAndSettings(_githubPat, _version, *flagArchivesSubDir)
+		setupBaseConfigAndSettings(_githubPat, _nomadPublicKey, _version, *flagArchivesSubDir)
 		action := strings.ToLower(flag.Arg(0))
 
 		//VERSION
@@ -122,7 +173,10 @@ func Main(_embeddedDefs embed.FS, _githubPat string, _version string, _versionEx
 			customUsage()
 			return EXIT_OK
 		} else {
+			ctx, cancel := cancelOnSignal()
+			defer cancel()
 			return doAction(
+				ctx,
 				flagDefinitionsDirectory,
 				flagVersion,
 				flagLatestVersion,
@@ -134,6 +188,17 @@ func Main(_embeddedDefs embed.FS, _githubPat string, _version string, _versionEx
 				flagConfirm,
 				flagOptimist,
 				flagRefresh,
+				flagPurge,
+				flagBackup,
+				flagStrict,
+				flagRestore,
+				flagFrozen,
+				flagDryRun,
+				flagFix,
+				flagOutput,
+				flagTemplate,
+				flagJobs,
+				flagWait,
 				_embeddedDefs)
 
 		}
@@ -143,7 +208,8 @@ func Main(_embeddedDefs embed.FS, _githubPat string, _version string, _versionEx
 
 }
 
-func doAction(flagDefinitionsDirectory *string,
+func doAction(ctx context.Context,
+	flagDefinitionsDirectory *string,
 	flagVersion *string,
 	flagLatestVersion *bool,
 	action string,
@@ -154,6 +220,17 @@ func doAction(flagDefinitionsDirectory *string,
 	flagConfirm *bool,
 	flagOptimist *bool,
 	flagRefresh *bool,
+	flagPurge *bool,
+	flagBackup *bool,
+	flagStrict *bool,
+	flagRestore *bool,
+	flagFrozen *bool,
+	flagDryRun *bool,
+	flagFix *bool,
+	flagOutput *string,
+	flagTemplate *string,
+	flagJobs *int,
+	flagWait *time.Duration,
 	embeddedDefinitions embed.FS) int {
 	//LOAD CONFIG/app definitions
 	configuration.Load("nomad.toml", *flagDefinitionsDirectory, embeddedDefinitions)
@@ -161,13 +238,52 @@ func doAction(flagDefinitionsDirectory *string,
 	//sanitize input
 	action = strings.ToLower(action)
 
+	//Only one nomad at a time changes apps directory
+	busy := false
+	if needsProcessLock(action, *flagDryRun, *flagFix) {
+		processLock, exitCode := lockApps(ctx, *flagWait)
+		if processLock == nil {
+			return exitCode
+		}
+		defer func() {
+			if err := processLock.Unlock(); err != nil {
+				log.Warnln("Cannot release apps directory lock |", err)
+			}
+		}()
+	} else if holder, running := state.AppsBusy(configuration.AppPath); running {
+		log.Infoln("Another nomad process is changing apps directory, shown state may be outdated |", holder)
+		busy = true
+	}
+
+	//Operations interrupted by a crash (not the ones of a running process)
+	if !busy && !strings.HasPrefix(action, "rec") {
+		warnUnfinishedOperations()
+	}
+
 	//LIST available APPS
-	if strings.HasPrefix(action, "l") {
+	if strings.HasPrefix(action, "l") && !strings.HasPrefix(action, "lo") /*LOCK*/ {
+		if *flagOutput != OUTPUT_LOG {
+			var records []listRecord
+			for app, definition := range configuration.Settings.AppDefinitions {
+				records = append(records, listRecord{App: app, Version: definition.Version, Repository: definition.RepositoryUrl})
+			}
+			return printAndGetExitCode(printRecords(os.Stdout, *flagOutput, *flagTemplate, records), EXIT_OK)
+		}
 		var result []string
 		for app := range configuration.Settings.AppDefinitions {
 			result = append(result, app)
 		}
 		log.Infoln("Available apps:", strings.Join(result, ","))
+	} else if strings.HasPrefix(action, "rec") /*RECOVER*/ {
+		return HandleRun(installer.Recover(*flagDryRun))
+	} else if strings.HasPrefix(action, "d") /*DOCTOR*/ {
+		return doctor(*flagArchivesSubDir, *flagFix, *flagOutput, *flagTemplate)
+	} else if strings.HasPrefix(action, "p") /*PRUNE*/ {
+		return HandleRun(installer.Prune(
+			configuration.Settings.Retention,
+			*flagArchivesSubDir,
+			*flagDryRun,
+			*flagConfirm))
 	} else {
 
 		//Shortcut
@@ -182,6 +298,37 @@ func doAction(flagDefinitionsDirectory *string,
 			askedApps = flag.Args()[1:]
 		}
 
+		//USE/ROLLBACK (must be checked before upgrade)
+		if action == "use" || strings.HasPrefix(action, "ro") {
+			var targetVersion *versionLib.Version
+			if action == "use" {
+				if len(askedApps) != 2 {
+					log.Errorln("Usage:", exeName, "use <app> <version>")
+					return EXIT_BAD_USAGE
+				}
+				var err error
+				if targetVersion, err = versionLib.FromString(askedApps[1]); err != nil {
+					log.Errorln("Bad version format:", askedApps[1], "|", err)
+					return EXIT_BAD_USAGE
+				}
+				askedApps = askedApps[:1]
+			} else if len(askedApps) == 0 {
+				log.Warnln("Please specify app(s) to rollback")
+				return EXIT_NO_VALID_APP
+			}
+
+			askedApps = state.FilterValidAskedApps(askedApps)
+			if len(askedApps) == 0 {
+				log.Warnln("No valid app name given")
+				return EXIT_NO_VALID_APP
+			}
+
+			exitCode, records := useVersion(ctx, state.LoadAskedAppsInitialStates(askedApps), targetVersion,
+				*flagEnvVarForAppsLocation, *flagRestore, *flagOptimist)
+			showSummary(records)
+			return printResults(*flagOutput, *flagTemplate, records, exitCode)
+		}
+
 		if len(askedApps) > 0 {
 			askedApps = state.FilterValidAskedApps(askedApps)
 			if len(askedApps) == 0 {
@@ -190,22 +337,106 @@ func doAction(flagDefinitionsDirectory *string,
 			}
 		}
 
+		//UNINSTALL (must be checked before upgrade)
+		if strings.HasPrefix(action, "un") {
+			//Never guess what to remove...
+			if len(askedApps) == 0 {
+				log.Warnln("Please specify app(s) to uninstall")
+				return EXIT_NO_VALID_APP
+			}
+
+			askedStates := state.LoadAskedAppsInitialStates(askedApps)
+			plans := uninstallPlans(askedStates, *flagArchivesSubDir, *flagPurge, *flagBackup)
+			showPlans(plans)
+
+			hasWork := false
+			for _, plan := range plans {
+				hasWork = hasWork || plan.HasWork()
+			}
+			if proceed, exitCode := confirmPlans(hasWork, *flagDryRun, *flagConfirm); !proceed {
+				return printResults(*flagOutput, *flagTemplate, planRecords(askedStates), exitCode)
+			}
+
+			exitCode, records := uninstallApps(plans, *flagOptimist)
+			showSummary(records)
+			return printResults(*flagOutput, *flagTemplate, records, exitCode)
+		}
+
+		//SYNC (must be checked before status)
+		isSync := strings.HasPrefix(action, "sy")
+		if isSync {
+			askedApps = state.FilterValidAskedApps(configuration.Settings.MyApps)
+			if len(askedApps) == 0 {
+				log.Warnln("No valid app found in myapps (nomad.toml)")
+				return EXIT_NO_VALID_APP
+			}
+		}
+
+		//LOCK (defaults to myapps, then installed apps)
+		isLock := strings.HasPrefix(action, "lo")
+		if isLock && len(askedApps) == 0 && len(configuration.Settings.MyApps) > 0 {
+			askedApps = state.FilterValidAskedApps(configuration.Settings.MyApps)
+		}
+
+		//FROZEN (defaults to locked apps)
+		var lockFile data.LockFile
+		if *flagFrozen {
+			var err error
+			if lockFile, err = installer.ReadLockFile(configuration.LockFileName); err != nil {
+				log.Errorln("Cannot read", configuration.LockFileName, "(use lock action to create it) |", err)
+				return installer.EXIT_LOCK_ERROR
+			}
+			if len(askedApps) == 0 {
+				for app := range lockFile.Apps {
+					askedApps = append(askedApps, app)
+				}
+				askedApps = state.FilterValidAskedApps(askedApps)
+			}
+		}
+
 		//Load APPS states and possible actions (upgrade...)
 		askedStates := state.LoadAskedAppsInitialStates(askedApps)
-		err := state.DeterminePossibleActions(
-			askedStates,
-			*flagVersion,
-			*flagLatestVersion,
-			configuration.Settings.GithubApiKey)
-
-		if err != nil {
-			log.Errorln("Cannot determine possible actions |", err)
-			return EXIT_ACTION
+		if *flagFrozen {
+			if err := installer.Freeze(askedStates, lockFile); err != nil {
+				log.Errorln("Cannot use", configuration.LockFileName, "|", err)
+				return installer.EXIT_LOCK_ERROR
+			}
+		} else {
+			err := state.DeterminePossibleActions(
+				ctx,
+				askedStates,
+				*flagVersion,
+				*flagLatestVersion,
+				configuration.Settings.GithubApiKey)
+
+			if ctx.Err() != nil {
+				log.Warnln("Canceled")
+				return installer.EXIT_CANCELED
+			} else if err != nil {
+				log.Errorln("Cannot determine possible actions |", err)
+				return EXIT_ACTION
+			}
 		}
 
-		//STATUS
-		if strings.HasPrefix(action, "s") {
-			if len(askedStates) == 0 {
+		//LOCK
+		if isLock {
+			return HandleRun(installer.Lock(ctx, askedStates, *flagArchivesSubDir, *flagSkipDownload,
+				configuration.LockFileName, len(flag.Args()) > 1))
+		}
+
+		//SYNC
+		if isSync {
+			exitCode, records := syncApps(ctx, askedStates, *flagForceExtract, *flagSkipDownload, *flagEnvVarForAppsLocation,
+				*flagArchivesSubDir, *flagRefresh, *flagStrict, *flagPurge, *flagBackup, *flagDryRun, *flagConfirm, *flagOptimist, *flagJobs)
+			return printResults(*flagOutput, *flagTemplate, records, exitCode)
+		} else if strings.HasPrefix(action, "s") /*STATUS*/ {
+			if *flagOutput != OUTPUT_LOG {
+				records := make([]statusRecord, 0, len(askedStates))
+				for app, appState := range askedStates {
+					records = append(records, buildStatusRecord(app, appState))
+				}
+				return printAndGetExitCode(printRecords(os.Stdout, *flagOutput, *flagTemplate, records), EXIT_OK)
+			} else if len(askedStates) == 0 {
 				log.Infoln("No app yet installed")
 			} else {
 				for app, appState := range askedStates {
@@ -215,25 +446,21 @@ func doAction(flagDefinitionsDirectory *string,
 		} else if slices.IndexFunc([]string{"i", "u"}, func(e string) bool {
 			return strings.HasPrefix(action, e)
 		}) != -1 {
-			//Do the job
-			for app, appState := range askedStates {
-				log.Debugln("Processing", app)
-
-				exitCode := HandleRun(
-					installer.InstallOrUpdate(
-						*appState,
-						*flagForceExtract,
-						*flagSkipDownload,
-						*flagEnvVarForAppsLocation,
-						*flagArchivesSubDir,
-						*flagConfirm,
-						*flagRefresh,
-					))
-				if exitCode != EXIT_OK && !(*flagOptimist) {
-					return exitCode
-				}
+			plans := installPlans(askedStates, *flagForceExtract, *flagSkipDownload, *flagArchivesSubDir, *flagRefresh)
+			showPlans(plans)
+			hasWork := false
+			for _, plan := range plans {
+				hasWork = hasWork || plan.HasWork(*flagRefresh)
+			}
+			if proceed, exitCode := confirmPlans(hasWork, *flagDryRun, *flagConfirm); !proceed {
+				return printResults(*flagOutput, *flagTemplate, planRecords(askedStates), exitCode)
 			}
 
+			//Do the job
+			exitCode, records := installOrUpdateApps(ctx, askedStates, *flagForceExtract, *flagSkipDownload, *flagEnvVarForAppsLocation,
+				*flagArchivesSubDir, *flagRefresh, *flagOptimist, *flagJobs)
+			showSummary(records)
+			return printResults(*flagOutput, *flagTemplate, records, exitCode)
 		} else {
 			log.Errorln("Unknown action", action)
 			return EXIT_UNKNOWN_ACTION
@@ -242,20 +469,448 @@ func doAction(flagDefinitionsDirectory *string,
 	return EXIT_OK
 }
 
+// syncApps installs/updates askedStates and, if strict, uninstalls other installed apps (nomad excepted)
+func syncApps(ctx context.Context, askedStates state.AppStates, forceExtract bool, skipDownload bool, envVarForAppsLocation string,
+	archivesSubDir string, refresh bool, strict bool, purge bool, backup bool, dryRun bool, confirm bool, optimist bool, jobs int) (int, []resultRecord) {
+	plans := installPlans(askedStates, forceExtract, skipDownload, archivesSubDir, refresh)
+	showPlans(plans)
+	hasWork := false
+	for _, plan := range plans {
+		hasWork = hasWork || plan.HasWork(refresh)
+	}
+
+	//Installed apps not wanted anymore
+	extraStates := state.NewAppStates()
+	for app, appState := range state.ScanCurrentApps(configuration.AppPath) {
+		if _, asked := askedStates[app]; app != "nomad" && !asked {
+			extraStates[app] = appState
+		}
+	}
+	var extraPlans map[string]installer.UninstallPlan
+	if strict {
+		extraPlans = uninstallPlans(extraStates, archivesSubDir, purge, backup)
+		showPlans(extraPlans)
+		for _, plan := range extraPlans {
+			hasWork = hasWork || plan.HasWork()
+		}
+	} else {
+		for app := range extraStates {
+			log.Warn(helper.BuildPrefix(app), "installed but not in myapps (use -strict to uninstall)")
+		}
+	}
+
+	if proceed, exitCode := confirmPlans(hasWork, dryRun, confirm); !proceed {
+		return exitCode, append(planRecords(askedStates), planRecords(extraStates)...)
+	}
+
+	exitCode, records := installOrUpdateApps(ctx, askedStates, forceExtract, skipDownload, envVarForAppsLocation,
+		archivesSubDir, refresh, optimist, jobs)
+	if (exitCode == EXIT_OK || optimist) && len(extraPlans) > 0 && ctx.Err() == nil {
+		uninstallExitCode, uninstallRecords := uninstallApps(extraPlans, optimist)
+		records = append(records, uninstallRecords...)
+		if optimist {
+			exitCode = aggregateExitCode(records)
+		} else {
+			exitCode = uninstallExitCode
+		}
+	}
+	showSummary(records)
+	return exitCode, records
+}
+
+// installPlans computes what install/upgrade would do for each app (without side effect)
+func installPlans(states state.AppStates, forceExtract bool, skipDownload bool, archivesSubDir string, refresh bool) map[string]installer.Plan {
+	plans := map[string]installer.Plan{}
+	for app, appState := range states {
+		plans[app] = installer.BuildPlan(*appState, forceExtract, skipDownload, archivesSubDir, refresh)
+	}
+	return plans
+}
+
+// uninstallPlans computes what uninstall would remove for each app (without side effect)
+func uninstallPlans(states state.AppStates, archivesSubDir string, purge bool, backup bool) map[string]installer.UninstallPlan {
+	plans := map[string]installer.UninstallPlan{}
+	for app, appState := range states {
+		appState.Status = state.UNINSTALL
+		plans[app] = installer.BuildUninstallPlan(*appState, archivesSubDir, purge, backup)
+	}
+	return plans
+}
+
+// showPlans logs plans lines (sorted by app name)
+func showPlans[T interface{ Describe() []string }](plans map[string]T) {
+	apps := make([]string, 0, len(plans))
+	for app := range plans {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	for _, app := range apps {
+		for _, line := range plans[app].Describe() {
+			log.Info(helper.BuildPrefix(app), line)
+		}
+	}
+}
+
+// confirmPlans asks once (if needed) before applying plans
+// returns false if nothing must be applied with the exit code to use
+func confirmPlans(hasWork bool, dryRun bool, confirm bool) (bool, int) {
+	if !hasWork {
+		log.Infoln("Nothing to do")
+		return false, EXIT_OK
+	}
+	if dryRun {
+		log.Infoln("Dry run, nothing changed")
+		return false, EXIT_OK
+	}
+	if !installer.UserWantsToContinue(confirm) {
+		log.Warnln("Action aborted by user")
+		return false, installer.EXIT_ABORTED_BY_USER
+	}
+	return true, EXIT_OK
+}
+
+func planRecords(states state.AppStates) (records []resultRecord) {
+	for app, appState := range states {
+		records = append(records, buildResultRecord(app, appState, nil, "", EXIT_OK, 0))
+	}
+	return
+}
+
+// installOrUpdateApps processes apps with a pool of jobs workers
+// With more than one job, logs of an app are kept together and shown once it is done (followed by a summary)
+// Once ctx is canceled, no more app is started (running ones undo their changes)
+func installOrUpdateApps(ctx context.Context, states state.AppStates, forceExtract bool, skipDownload bool, envVarForAppsLocation string,
+	archivesSubDir string, refresh bool, optimist bool, jobs int) (int, []resultRecord) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	apps := make([]string, 0, len(states))
+	for app := range states {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	var records []resultRecord
+	exitCode := EXIT_OK
+	var mutex sync.Mutex //protects records, exitCode and grouped output
+
+	queue := make(chan string)
+	var workers sync.WaitGroup
+	workers.Add(jobs)
+	for worker := 0; worker < jobs; worker++ {
+		go func() {
+			defer workers.Done()
+			for app := range queue {
+				appState := states[app]
+				var output *bytes.Buffer
+				if jobs > 1 {
+					output = &bytes.Buffer{}
+					appState.Log = helper.NewAppLogger(app, output)
+				} else {
+					appState.Log = helper.NewAppLogger(app, log.Writer())
+				}
+				logger := appState.Logger()
+				logger.Debugln("Processing", app)
+
+				start := time.Now()
+				err, errorMessage, appExitCode := installer.InstallOrUpdate(
+					ctx,
+					appState,
+					forceExtract,
+					skipDownload,
+					envVarForAppsLocation,
+					archivesSubDir,
+					refresh,
+				)
+				handleAppRun(logger, err, errorMessage, appExitCode)
+
+				mutex.Lock()
+				if output != nil {
+					if _, err := log.Writer().Write(output.Bytes()); err != nil {
+						log.Errorln("Cannot write", app, "logs |", err)
+					}
+				}
+				records = append(records, buildResultRecord(app, appState, err, errorMessage, appExitCode, time.Since(start)))
+				if appExitCode != EXIT_OK && exitCode == EXIT_OK {
+					exitCode = appExitCode
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, app := range apps {
+		mutex.Lock()
+		stop := (exitCode != EXIT_OK && !optimist) || ctx.Err() != nil
+		mutex.Unlock()
+		if stop {
+			break
+		}
+		queue <- app
+	}
+	close(queue)
+	workers.Wait()
+
+	if ctx.Err() != nil {
+		return installer.EXIT_CANCELED, records
+	} else if optimist {
+		return aggregateExitCode(records), records
+	}
+	return exitCode, records
+}
+
+// aggregateExitCode returns the exit code of a run that continued after failures (optimist)
+// A single app keeps its own exit code, several apps with at least one failure give EXIT_PARTIAL_FAILURE
+func aggregateExitCode(records []resultRecord) int {
+	for _, record := range records {
+		if record.ExitCode != EXIT_OK {
+			if len(records) == 1 {
+				return record.ExitCode
+			}
+			return EXIT_PARTIAL_FAILURE
+		}
+	}
+	return EXIT_OK
+}
+
+// showSummary logs a table of processed apps (stderr, records printed with -output go to stdout)
+func showSummary(records []resultRecord) {
+	if len(records) == 0 {
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].App < records[j].App
+	})
+
+	table := bytes.Buffer{}
+	writer := tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "APP\tSTATUS\tFROM\tTO\tDURATION\tDOWNLOADED\tRESULT")
+	failed := 0
+	for _, record := range records {
+		result := "ok"
+		if record.ExitCode != EXIT_OK {
+			failed++
+			result = fmt.Sprint("failed (", record.ExitCode, ") ", record.Error)
+		}
+		fmt.Fprintln(writer, strings.Join([]string{record.App, record.Status, record.CurrentVersion, record.TargetVersion,
+			record.Duration, bytesize.ByteSize(record.Downloaded).String(), result}, "\t"))
+	}
+	if err := writer.Flush(); err != nil {
+		log.Errorln("Cannot build summary |", err)
+		return
+	}
+
+	log.Infoln("Summary:")
+	for _, line := range strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n") {
+		log.Info(line)
+	}
+	if failed > 0 {
+		log.Errorln(failed, "of", len(records), "apps failed")
+	} else {
+		log.Infoln(len(records), "apps ok")
+	}
+}
+
+func uninstallApps(plans map[string]installer.UninstallPlan, optimist bool) (int, []resultRecord) {
+	apps := make([]string, 0, len(plans))
+	for app := range plans {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	var records []resultRecord
+	for _, app := range apps {
+		plan := plans[app]
+		log.Debugln("Uninstalling", app)
+
+		start := time.Now()
+		err, errorMessage, exitCode := installer.Uninstall(plan)
+		records = append(records, buildResultRecord(app, &plan.AppState, err, errorMessage, exitCode, time.Since(start)))
+		if handleAppRun(plan.AppState.Logger(), err, errorMessage, exitCode) != EXIT_OK && !optimist {
+			return exitCode, records
+		}
+	}
+	return aggregateExitCode(records), records
+}
+
+// useVersion switches apps to targetVersion (or previous installed version if nil)
+func useVersion(ctx context.Context, states state.AppStates, targetVersion *versionLib.Version, envVarForAppsLocation string, restore bool, optimist bool) (int, []resultRecord) {
+	var records []resultRecord
+	for app, appState := range states {
+		if ctx.Err() != nil {
+			return installer.EXIT_CANCELED, records
+		}
+		log.Debugln("Switching", app, "to", targetVersion)
+
+		start := time.Now()
+		err, errorMessage, exitCode := installer.Use(
+			ctx,
+			appState,
+			targetVersion,
+			envVarForAppsLocation,
+			restore,
+		)
+		records = append(records, buildResultRecord(app, appState, err, errorMessage, exitCode, time.Since(start)))
+		if handleAppRun(appState.Logger(), err, errorMessage, exitCode) != EXIT_OK && !optimist {
+			return exitCode, records
+		}
+	}
+	return aggregateExitCode(records), records
+}
+
+// cancelOnSignal returns a context canceled by ctrl-c or SIGTERM
+// Running operations then undo their changes, a second signal stops nomad at once (see recover)
+func cancelOnSignal() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case received := <-signals:
+			log.Warnln("Received", received, "signal, canceling (send it again to force exit)")
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// needsProcessLock tells if action changes apps directory (read-only actions and dry runs never wait for another nomad)
+func needsProcessLock(action string, dryRun bool, fix bool) bool {
+	switch {
+	case strings.HasPrefix(action, "d"): //DOCTOR
+		return fix
+	case dryRun:
+		return false
+	case strings.HasPrefix(action, "l") && !strings.HasPrefix(action, "lo"): //LIST
+		return false
+	case strings.HasPrefix(action, "s") && !strings.HasPrefix(action, "se") && !strings.HasPrefix(action, "sy"): //STATUS
+		return false
+	default:
+		return true
+	}
+}
+
+// lockApps takes apps directory lock (see state.LockApps), returns nil and exit code if not possible
+func lockApps(ctx context.Context, wait time.Duration) (*state.ProcessLock, int) {
+	if holder, running := state.AppsBusy(configuration.AppPath); running && wait > 0 {
+		log.Infoln("Waiting up to", wait, "for another nomad process |", holder)
+	}
+	processLock, stale, err := state.LockApps(ctx, configuration.AppPath, wait)
+	if ctx.Err() != nil {
+		log.Warnln("Canceled")
+		return nil, installer.EXIT_CANCELED
+	} else if errors.Is(err, state.ErrBusy) {
+		log.Errorln(err, "| please retry later or use -wait (example: -wait=5m)")
+		return nil, EXIT_BUSY
+	} else if err != nil {
+		log.Errorln("Cannot lock apps directory |", err)
+		return nil, EXIT_BUSY
+	}
+	if stale != nil {
+		log.Warnln("Previous nomad process stopped without releasing apps directory |", stale)
+	}
+	return processLock, EXIT_OK
+}
+
+// warnUnfinishedOperations tells about journals left by a crash (see recover)
+func warnUnfinishedOperations() {
+	journals, err := state.UnfinishedJournals(configuration.AppPath)
+	if err != nil {
+		log.Warnln("Cannot read journals |", err)
+	}
+	for _, journal := range journals {
+		log.Warnln(helper.BuildPrefix(journal.App), "unfinished", journal, "(please run", exeName, "recover)")
+	}
+}
+
+// doctor reports (and fixes if asked) problems found in apps tree
+func doctor(archivesSubDir string, fix bool, output string, templateText string) int {
+	problems := installer.Diagnose(archivesSubDir)
+
+	var records []problemRecord
+	exitCode := EXIT_OK
+	for _, problem := range problems {
+		if fix && problem.Fixable() {
+			if err := problem.Fix(); err != nil {
+				log.Errorln("Cannot fix", problem.Path, "|", err)
+			}
+		}
+
+		if output == OUTPUT_LOG {
+			var status string
+			if problem.Fixed {
+				status = " [fixed]"
+			} else if problem.Fixable() {
+				status = " [fixable with -fix]"
+			}
+			switch problem.Severity {
+			case installer.SEVERITY_ERROR:
+				log.Errorln(problem.Path, "|", problem.Message+status)
+			case installer.SEVERITY_WARNING:
+				log.Warnln(problem.Path, "|", problem.Message+status)
+			default:
+				log.Infoln(problem.Path, "|", problem.Message+status)
+			}
+		}
+
+		if problem.Severity != installer.SEVERITY_INFO && !problem.Fixed {
+			exitCode = EXIT_HEALTH_PROBLEMS
+		}
+		records = append(records, problemRecord{
+			Severity: problem.Severity.String(),
+			Path:     problem.Path,
+			Message:  problem.Message,
+			Fixable:  problem.Fixable(),
+			Fixed:    problem.Fixed,
+		})
+	}
+
+	if output != OUTPUT_LOG {
+		return printAndGetExitCode(printRecords(os.Stdout, output, templateText, records), exitCode)
+	} else if len(problems) == 0 {
+		log.Infoln("No problem found")
+	}
+	return exitCode
+}
+
+// printResults prints records if an output format is set and keeps the given exit code (unless printing fails)
+func printResults(format string, templateText string, records []resultRecord, exitCode int) int {
+	if format == OUTPUT_LOG {
+		return exitCode
+	}
+	return printAndGetExitCode(printRecords(os.Stdout, format, templateText, records), exitCode)
+}
+
+func printAndGetExitCode(err error, exitCode int) int {
+	if err != nil {
+		log.Errorln("Cannot print output |", err)
+		return EXIT_OUTPUT_ERROR
+	}
+	return exitCode
+}
+
 func HandleRun(err error, errorMessage string, exitCode int) int {
-	defer log.SetPrefix("")
+	return handleAppRun(log.Default(), err, errorMessage, exitCode)
+}
 
+// handleAppRun logs the outcome of an action with given (app) logger
+func handleAppRun(logger *log.Logger, err error, errorMessage string, exitCode int) int {
 	if exitCode == 0 {
-		log.Debugln("**All seemed to go well ;-)")
+		logger.Debugln("**All seemed to go well ;-)")
 	} else {
 		if errorMessage != "" {
 			if err != nil {
-				log.Error(errorMessage, " | ", err.Error())
+				logger.Error(errorMessage, " | ", err.Error())
 			} else {
-				log.Error(errorMessage)
+				logger.Error(errorMessage)
 			}
 		} else if err != nil {
-			log.Error(err.Error())
+			logger.Error(err.Error())
 		}
 	}
 
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/installer"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	versionLib "github.com/jonathanMelly/nomad/pkg/version"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_installOrUpdateAppsJobs(t *testing.T) {
+	states := state.NewAppStates()
+	for i := 0; i < 5; i++ {
+		app := fmt.Sprint("app", i)
+		//invalid definitions fail fast, without side effect
+		states[app] = &state.AppState{Definition: &data.AppDefinition{ApplicationName: app}, Status: state.INSTALL}
+	}
+
+	exitCode, records := installOrUpdateApps(context.Background(), states, false, true, "", "archives", false, true, 3)
+
+	assert.Eq(t, EXIT_PARTIAL_FAILURE, exitCode)
+	assert.Len(t, records, 5)
+	for _, record := range records {
+		assert.Eq(t, installer.EXIT_INVALID_DEFINITION, record.ExitCode)
+		assert.NotNil(t, states[record.App].Log)
+	}
+
+	exitCode, records = installOrUpdateApps(context.Background(), states, false, true, "", "archives", false, false, 1)
+
+	assert.Eq(t, installer.EXIT_INVALID_DEFINITION, exitCode)
+	assert.Len(t, records, 1)
+}
+
+func Test_uninstallAppsOrder(t *testing.T) {
+	plans := map[string]installer.UninstallPlan{}
+	for _, app := range []string{"app3", "app1", "app4", "app0", "app2"} {
+		//invalid definitions fail fast, without side effect
+		plans[app] = installer.UninstallPlan{AppState: state.AppState{Definition: &data.AppDefinition{ApplicationName: app}}}
+	}
+
+	_, records := uninstallApps(plans, true)
+	assert.Len(t, records, 5)
+	for index, record := range records {
+		assert.Eq(t, fmt.Sprint("app", index), record.App)
+	}
+
+	//Stops at first app
+	_, records = uninstallApps(plans, false)
+	assert.Len(t, records, 1)
+	assert.Eq(t, "app0", records[0].App)
+}
+
+func Test_aggregateExitCode(t *testing.T) {
+	ok := resultRecord{App: "ok"}
+	failed := resultRecord{App: "failed", ExitCode: installer.EXIT_INSTALL_UPDATE_ERROR}
+
+	assert.Eq(t, EXIT_OK, aggregateExitCode(nil))
+	assert.Eq(t, EXIT_OK, aggregateExitCode([]resultRecord{ok, ok}))
+	assert.Eq(t, installer.EXIT_INSTALL_UPDATE_ERROR, aggregateExitCode([]resultRecord{failed}))
+	assert.Eq(t, EXIT_PARTIAL_FAILURE, aggregateExitCode([]resultRecord{ok, failed}))
+}
+
+func Test_needsProcessLock(t *testing.T) {
+	tests := []struct {
+		action string
+		dryRun bool
+		fix    bool
+		want   bool
+	}{
+		{"status", false, false, false},
+		{"list", false, false, false},
+		{"doctor", false, false, false},
+		{"doctor", false, true, true},
+		{"install", true, false, false},
+		{"install", false, false, true},
+		{"sync", false, false, true},
+		{"self", false, false, true},
+		{"lock", false, false, true},
+		{"use", false, false, true},
+		{"recover", false, false, true},
+		{"recover", true, false, false},
+	}
+	for _, tt := range tests {
+		assert.Eq(t, tt.want, needsProcessLock(tt.action, tt.dryRun, tt.fix), tt.action)
+	}
+}
+
+func Test_syncApps(t *testing.T) {
+	appPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = appPath }()
+
+	definitions := map[string]*data.AppDefinition{}
+	for _, app := range []string{"missing", "outdated", "extra"} {
+		definitions[app] = &data.AppDefinition{ApplicationName: app, Symlink: app, Version: "2.0.0", DownloadUrl: "https://example.org/" + app + "-{{VERSION}}.zip"}
+		definitions[app].ComputeDownloadExtension()
+	}
+	formerDefinitions := configuration.Settings.AppDefinitions
+	configuration.Settings.AppDefinitions = definitions
+	defer func() { configuration.Settings.AppDefinitions = formerDefinitions }()
+
+	//Cached archives (no download)
+	archives := filepath.Join(configuration.AppPath, "archives")
+	assert.NoError(t, os.MkdirAll(archives, os.ModePerm))
+	for _, app := range []string{"missing", "outdated"} {
+		content := bytes.Buffer{}
+		writer := zip.NewWriter(&content)
+		file, _ := writer.Create(app + "/" + app + ".txt")
+		_, _ = file.Write([]byte(app))
+		assert.NoError(t, writer.Close())
+		assert.NoError(t, os.WriteFile(filepath.Join(archives, app+"-2.0.0.zip"), content.Bytes(), os.ModePerm))
+	}
+
+	//Installed apps
+	for _, folder := range []string{"outdated-1.0.0", "extra-1.0.0"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(configuration.AppPath, folder), os.ModePerm))
+	}
+
+	oldVersion, _ := versionLib.FromString("1.0.0")
+	newVersion, _ := versionLib.FromString("2.0.0")
+	askedStates := state.NewAppStates()
+	askedStates["missing"] = &state.AppState{Definition: definitions["missing"], TargetVersion: newVersion, Status: state.INSTALL}
+	askedStates["outdated"] = &state.AppState{Definition: definitions["outdated"], CurrentVersion: oldVersion,
+		CurrentVersionFolder: filepath.Join(configuration.AppPath, "outdated-1.0.0"), TargetVersion: newVersion, Status: state.UPGRADE}
+
+	//Not strict: extra app is kept
+	exitCode, records := syncApps(context.Background(), askedStates, false, true, "", "archives", false, false, false, false, true, false, false, 1)
+	assert.Eq(t, EXIT_OK, exitCode)
+	assert.Len(t, records, 3)
+	assert.False(t, helper.FileOrDirExists(filepath.Join(configuration.AppPath, "missing-2.0.0")))
+
+	exitCode, records = syncApps(context.Background(), askedStates, false, true, "", "archives", false, true, false, false, false, false, false, 1)
+
+	assert.Eq(t, EXIT_OK, exitCode)
+	assert.Len(t, records, 3)
+	for _, record := range records {
+		assert.Eq(t, EXIT_OK, record.ExitCode)
+	}
+	assert.True(t, helper.FileOrDirExists(filepath.Join(configuration.AppPath, "missing-2.0.0", "missing.txt")))
+	assert.True(t, helper.FileOrDirExists(filepath.Join(configuration.AppPath, "outdated-2.0.0", "outdated.txt")))
+	for _, app := range []string{"missing", "outdated"} {
+		absoluteTarget, _ := filepath.Abs(filepath.Join(configuration.AppPath, app+"-2.0.0"))
+		assert.Eq(t, absoluteTarget, helper.GetSymlinkTarget(filepath.Join(configuration.AppPath, app)))
+	}
+	assert.False(t, helper.FileOrDirExists(filepath.Join(configuration.AppPath, "extra-1.0.0")))
+}
@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"gopkg.in/yaml.v3"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	OUTPUT_LOG      = ""
+	OUTPUT_JSON     = "json"
+	OUTPUT_YAML     = "yaml"
+	OUTPUT_TABLE    = "table"
+	OUTPUT_TEMPLATE = "template"
+)
+
+var outputFormats = []string{OUTPUT_JSON, OUTPUT_YAML, OUTPUT_TABLE, OUTPUT_TEMPLATE}
+
+// statusRecord is emitted by status
+type statusRecord struct {
+	App            string `json:"app" yaml:"app"`
+	CurrentVersion string `json:"currentVersion" yaml:"currentVersion"`
+	TargetVersion  string `json:"targetVersion" yaml:"targetVersion"`
+	Status         string `json:"status" yaml:"status"`
+	Symlink        bool   `json:"symlink" yaml:"symlink"`
+	Folder         string `json:"folder" yaml:"folder"`
+}
+
+// resultRecord is emitted by install/upgrade/sync/uninstall (one per app)
+type resultRecord struct {
+	App            string `json:"app" yaml:"app"`
+	Status         string `json:"status" yaml:"status"`
+	CurrentVersion string `json:"currentVersion" yaml:"currentVersion"`
+	TargetVersion  string `json:"targetVersion" yaml:"targetVersion"`
+	Duration       string `json:"duration" yaml:"duration"`
+	Downloaded     int64  `json:"downloaded" yaml:"downloaded"` //bytes
+	ExitCode       int    `json:"exitCode" yaml:"exitCode"`
+	Error          string `json:"error" yaml:"error"`
+}
+
+// listRecord is emitted by list
+type listRecord struct {
+	App        string `json:"app" yaml:"app"`
+	Version    string `json:"version" yaml:"version"`
+	Repository string `json:"repository" yaml:"repository"`
+}
+
+// problemRecord is emitted by doctor
+type problemRecord struct {
+	Severity string `json:"severity" yaml:"severity"`
+	Path     string `json:"path" yaml:"path"`
+	Message  string `json:"message" yaml:"message"`
+	Fixable  bool   `json:"fixable" yaml:"fixable"`
+	Fixed    bool   `json:"fixed" yaml:"fixed"`
+}
+
+func validateOutputFormat(format string, templateText string) error {
+	if format == OUTPUT_LOG {
+		return nil
+	}
+	for _, known := range outputFormats {
+		if format == known {
+			if format == OUTPUT_TEMPLATE && templateText == "" {
+				return errors.New("missing -template for template output")
+			}
+			return nil
+		}
+	}
+	return errors.New(fmt.Sprint("unknown output format ", format, " (expected one of ", strings.Join(outputFormats, ","), ")"))
+}
+
+func buildStatusRecord(app string, appState *state.AppState) statusRecord {
+	return statusRecord{
+		App:            app,
+		CurrentVersion: versionText(appState.CurrentVersion),
+		TargetVersion:  versionText(appState.TargetVersion),
+		Status:         appState.Status.String(),
+		Symlink:        appState.SymlinkFound,
+		Folder:         appState.CurrentVersionFolder,
+	}
+}
+
+func buildResultRecord(app string, appState *state.AppState, err error, errorMessage string, exitCode int, duration time.Duration) resultRecord {
+	var errorText []string
+	if errorMessage != "" {
+		errorText = append(errorText, errorMessage)
+	}
+	if err != nil {
+		errorText = append(errorText, err.Error())
+	}
+	return resultRecord{
+		App:            app,
+		Status:         appState.Status.String(),
+		CurrentVersion: versionText(appState.CurrentVersion),
+		TargetVersion:  versionText(appState.TargetVersion),
+		Duration:       durationText(duration),
+		Downloaded:     appState.Downloaded,
+		ExitCode:       exitCode,
+		Error:          strings.Join(errorText, " | "),
+	}
+}
+
+func durationText(duration time.Duration) string {
+	if duration == 0 {
+		return ""
+	}
+	return duration.Round(time.Millisecond).String()
+}
+
+func versionText(v *version.Version) string {
+	if v == nil {
+		return ""
+	}
+	return v.String()
+}
+
+// printRecords writes records (sorted by first field) to out using given format
+func printRecords[T statusRecord | resultRecord | listRecord | problemRecord](out io.Writer, format string, templateText string, records []T) error {
+	sort.SliceStable(records, func(i, j int) bool {
+		return reflect.ValueOf(records[i]).Field(0).String() < reflect.ValueOf(records[j]).Field(0).String()
+	})
+
+	switch format {
+	case OUTPUT_JSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case OUTPUT_YAML:
+		encoder := yaml.NewEncoder(out)
+		defer encoder.Close()
+		return encoder.Encode(records)
+	case OUTPUT_TABLE:
+		writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		recordType := reflect.TypeOf(*new(T))
+		var headers []string
+		for i := 0; i < recordType.NumField(); i++ {
+			headers = append(headers, strings.ToUpper(recordType.Field(i).Tag.Get("json")))
+		}
+		fmt.Fprintln(writer, strings.Join(headers, "\t"))
+		for _, record := range records {
+			value := reflect.ValueOf(record)
+			var cells []string
+			for i := 0; i < value.NumField(); i++ {
+				cells = append(cells, fmt.Sprint(value.Field(i).Interface()))
+			}
+			fmt.Fprintln(writer, strings.Join(cells, "\t"))
+		}
+		return writer.Flush()
+	case OUTPUT_TEMPLATE:
+		tmpl, err := template.New("output").Parse(templateText)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := tmpl.Execute(out, record); err != nil {
+				return err
+			}
+			fmt.Fprintln(out)
+		}
+		return nil
+	default:
+		return errors.New(fmt.Sprint("unknown output format ", format))
+	}
+}
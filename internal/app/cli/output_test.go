@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"bytes"
+	"github.com/gookit/goutil/testutil/assert"
+	"testing"
+)
+
+func Test_printRecords(t *testing.T) {
+	records := []resultRecord{
+		{App: "rclone", Status: "upgrade", CurrentVersion: "1.62.2", TargetVersion: "1.63.0", Duration: "2.5s", Downloaded: 1024},
+		{App: "git", Status: "install", TargetVersion: "2.45.1", ExitCode: 53, Error: "Cannot install/update app"},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		template string
+		want     string
+	}{
+		{"template", OUTPUT_TEMPLATE, "{{.App}}={{.ExitCode}}", "git=53\nrclone=0\n"},
+		{"table", OUTPUT_TABLE, "", "" +
+			"APP     STATUS   CURRENTVERSION  TARGETVERSION  DURATION  DOWNLOADED  EXITCODE  ERROR\n" +
+			"git     install                  2.45.1                   0           53        Cannot install/update app\n" +
+			"rclone  upgrade  1.62.2          1.63.0         2.5s      1024        0         \n"},
+		{"yaml", OUTPUT_YAML, "", "" +
+			"- app: git\n  status: install\n  currentVersion: \"\"\n  targetVersion: 2.45.1\n  duration: \"\"\n  downloaded: 0\n  exitCode: 53\n  error: Cannot install/update app\n" +
+			"- app: rclone\n  status: upgrade\n  currentVersion: 1.62.2\n  targetVersion: 1.63.0\n  duration: 2.5s\n  downloaded: 1024\n  exitCode: 0\n  error: \"\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			assert.NoError(t, printRecords(&out, tt.format, tt.template, records))
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func Test_validateOutputFormat(t *testing.T) {
+	assert.NoError(t, validateOutputFormat(OUTPUT_LOG, ""))
+	assert.NoError(t, validateOutputFormat(OUTPUT_JSON, ""))
+	assert.Error(t, validateOutputFormat(OUTPUT_TEMPLATE, ""))
+	assert.Error(t, validateOutputFormat("xml", ""))
+}
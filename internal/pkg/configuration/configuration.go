@@ -18,11 +18,38 @@ import (
 )
 
 var Version *version.Version
+
+// NomadPublicKey is the minisign key embedded at build time, trusted for self-update
+var NomadPublicKey string
 var Settings = data.NewSettings()
 var AppDefinitionDirectoryName = "app-definitions"
 
 const DefaultShortcutsDir = "shortcuts"
 
+// LockFileName is written next to nomad.toml
+const LockFileName = "nomad.lock"
+
+// DefaultBackupsDir is relative to AppPath
+const DefaultBackupsDir = "backups"
+
+// DataDirectorySuffix names the folder of persisted data of an app (app-data, relative to AppPath)
+const DataDirectorySuffix = "-data"
+
+// StateFileName records installs, relative to AppPath
+const StateFileName = ".nomad-state.json"
+
+// StagingDir holds versions being installed (promoted to AppPath once complete), relative to AppPath
+const StagingDir = ".staging"
+
+// JournalDir holds journals of unfinished operations (see nomad recover), relative to AppPath
+const JournalDir = ".journal"
+
+// ProcessLockName is locked by the nomad process changing AppPath (not to be confused with LockFileName), relative to AppPath
+const ProcessLockName = ".nomad-process.lock"
+
+// ProcessInfoName tells which process holds ProcessLockName, relative to AppPath
+const ProcessInfoName = ".nomad-process.json"
+
 var AppPath = "apps"
 
 func Load(globalSettingsPath string, customDefinitionsDirectory string, embeddedSrc embed.FS) {
@@ -39,8 +66,9 @@ func Load(globalSettingsPath string, customDefinitionsDirectory string, embedded
 		err := config2.BindStruct("", &Settings)
 		if err != nil {
 			log.Errorln("Cannot bind struct", err)
-		} else if log.GetLevel("debug") {
-			for k := range Settings.AppDefinitions {
+		} else {
+			for k, definition := range Settings.AppDefinitions {
+				definition.SetSource(globalSettingsPath)
 				log.Debugln("Added", k, "custom definition from", globalSettingsPath)
 			}
 		}
@@ -182,6 +210,7 @@ func fillDefinitions(identifier string, app string, definition data.AppDefinitio
 		if definition.ApplicationName == "" {
 			definition.ApplicationName = app
 		}
+		definition.SetSource(identifier)
 
 		if valid, err := definition.IsValid(); !valid {
 			log.Warnln("Invalid app definition", app, "|", err, "->discarding")
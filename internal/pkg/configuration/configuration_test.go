@@ -38,6 +38,7 @@ func TestLoadWithGlobalCustomAndMeta(t *testing.T) {
 	assert.Equal(t, ".bob", Settings.AppDefinitions["customJson"].DownloadExtension) //guessed from url
 	assert.ContainsKey(t, Settings.AppDefinitions, "customToml")
 	assert.Equal(t, ".zip", Settings.AppDefinitions["customToml"].DownloadExtension) //default
+	assert.Equal(t, "bin/app", Settings.AppDefinitions["customToml"].Platforms["plan9/arm"].Shortcut)
 	assert.ContainsKey(t, Settings.AppDefinitions, "customJson2")
 	assert.Equal(t, ".zap", Settings.AppDefinitions["customJson2"].DownloadExtension) //set
 
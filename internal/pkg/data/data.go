@@ -5,19 +5,45 @@ import (
 	"fmt"
 	"github.com/gologme/log"
 	"github.com/gookit/goutil/maputil"
+	"github.com/jonathanMelly/nomad/internal/pkg/render"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
 )
 
 const GITHUB_GRAPHQL_URL = "https://api.github.com/graphql"
 const GITHUB_PREFIX = "github"
 const GITHUB_BASE_URL = "https://github.com/"
+const GITHUB_API_URL = "https://api.github.com/"
 
 type Settings struct {
 	MyApps            []string                  `json:"myapps"`
 	GithubApiKey      string                    `json:"githubApiKey"`
 	AppDefinitions    map[string]*AppDefinition `json:"apps"`
 	ArchivesDirectory string                    `json:"archivesDirectory"`
+	Retention         Retention                 `json:"retention"`
+}
+
+// Retention rules used by prune (a value <= 0 or empty disables the rule)
+type Retention struct {
+	KeepVersions     int    `json:"keepVersions"`     //installed versions kept per app (symlinked one is always kept)
+	KeepArchivesDays int    `json:"keepArchivesDays"` //archives older than that are removed
+	MaxArchivesSize  string `json:"maxArchivesSize"`  //oldest archives are removed above that total size (ex: 2GB)
+}
+
+// LockFile pins resolved apps to exact archives (written by nomad lock, used by install -frozen)
+type LockFile struct {
+	Nomad string               `json:"nomad"` //version of nomad which wrote the file
+	Apps  map[string]LockedApp `json:"apps"`
+}
+
+type LockedApp struct {
+	Version     string `json:"version"`
+	DownloadUrl string `json:"downloadUrl"` //final URL (placeholders filled)
+	Size        int64  `json:"size"`
+	Sha256      string `json:"sha256"`
 }
 
 func NewSettings() *Settings {
@@ -25,6 +51,10 @@ func NewSettings() *Settings {
 		MyApps:         []string{},
 		GithubApiKey:   "",
 		AppDefinitions: map[string]*AppDefinition{},
+		Retention: Retention{
+			KeepVersions:     2,
+			KeepArchivesDays: 30,
+		},
 	}
 }
 
@@ -48,8 +78,10 @@ type AppDefinition struct {
 	//Optional fields
 	RepositoryUrl string `json:"RepositoryUrl"` //for easy config with github repos
 
-	ApplicationName   string `json:"ApplicationName"`   //extracted from filename if missing
-	DownloadExtension string `json:"DownloadExtension"` //extracted from download url if missing
+	ApplicationName   string    `json:"ApplicationName"`   //extracted from filename if missing
+	DownloadExtension string    `json:"DownloadExtension"` //extracted from download url if missing
+	Checksum          string    `json:"Checksum"`          //Optional, [sha256:|sha512:]hash or URL of a checksum file (placeholders allowed)
+	Signature         Signature `json:"Signature"`         //Optional, detached signature of archive
 
 	VersionCheck VersionCheck `json:"VersionCheck"` //optional
 	Symlink      string       `json:"Symlink"`      //use it instead of appname for symlink (if given)
@@ -59,13 +91,74 @@ type AppDefinition struct {
 	ExtractRegExList []string          `json:"ExtractRegExList"` //Optional
 	CreateFolders    []string          `json:"CreateFolders"`    //Optio
 	CreateFiles      map[string]string `json:"CreateFiles"`
+	OverwriteFiles   bool              `json:"OverwriteFiles"` //CreateFiles are rendered again even if they exist (ex: launchers on -refresh)
+	Templates        bool              `json:"Templates"`      //Templated fields are Go templates, else only placeholders ({{VERSION}}...) are replaced
 	NoAddVersionFile bool              //to avoid VERSION-{{VERSION}}.nomad file adding
 	MoveObjects      map[string]string `json:"MoveObjects"`
 	RestoreFiles     []string          `json:"RestoreFiles"` //Copy/Paste (overwrite) files from previous symlinked directory (needs symlink)
+	Persist          []string          `json:"Persist"`      //Folders kept once in apps/<app>-data and linked into each version (replaces RestoreFiles)
+
+	Platforms map[string]Platform `json:"Platforms"` //Optional, overrides by os/arch (ex: linux/amd64) or os (ex: linux)
 
 	//Internal stuff
 	validated    bool
 	extractRegex *regexp.Regexp
+	source       string
+}
+
+// Platform overrides definition fields on a given os/arch (empty fields are not overridden)
+type Platform struct {
+	DownloadUrl       string            `json:"DownloadUrl"` //extension is guessed again from it unless DownloadExtension is given
+	DownloadExtension string            `json:"DownloadExtension"`
+	ExtractRegExList  []string          `json:"ExtractRegExList"`
+	Shortcut          string            `json:"Shortcut"`
+	CreateFiles       map[string]string `json:"CreateFiles"`
+}
+
+// CurrentPlatform returns os/arch of running nomad (key of Platforms)
+func CurrentPlatform() string {
+	return fmt.Sprint(runtime.GOOS, "/", runtime.GOARCH)
+}
+
+// applyPlatform overrides fields with Platforms entry of platform (os/arch first, then os only)
+func (definition *AppDefinition) applyPlatform(platform string) {
+	override, found := definition.Platforms[platform]
+	if !found {
+		osOnly, _, _ := strings.Cut(platform, "/")
+		if override, found = definition.Platforms[osOnly]; !found {
+			return
+		}
+	}
+	log.Traceln("Using", platform, "variant of", definition.ApplicationName)
+
+	if override.DownloadUrl != "" {
+		definition.DownloadUrl = override.DownloadUrl
+		definition.DownloadExtension = override.DownloadExtension
+	} else if override.DownloadExtension != "" {
+		definition.DownloadExtension = override.DownloadExtension
+	}
+	if len(override.ExtractRegExList) > 0 {
+		definition.ExtractRegExList = override.ExtractRegExList
+	}
+	if override.Shortcut != "" {
+		definition.Shortcut = override.Shortcut
+	}
+	if override.CreateFiles != nil {
+		//Copy as version file is added to it
+		definition.CreateFiles = map[string]string{}
+		for name, body := range override.CreateFiles {
+			definition.CreateFiles[name] = body
+		}
+	}
+}
+
+// Source tells where the definition comes from (embedded, custom, nomad.toml)
+func (definition *AppDefinition) Source() string {
+	return definition.source
+}
+
+func (definition *AppDefinition) SetSource(source string) {
+	definition.source = source
 }
 
 func (definition *AppDefinition) validateAndSetDefaults() error {
@@ -79,6 +172,9 @@ func (definition *AppDefinition) validateAndSetDefaults() error {
 		errs = append(errs, "missing base version")
 	}
 
+	//PLATFORM (before defaults computed from overridable fields)
+	definition.applyPlatform(CurrentPlatform())
+
 	//SYMLINK
 	//Sets default symlink to app name
 	if definition.Symlink == "" {
@@ -96,6 +192,13 @@ func (definition *AppDefinition) validateAndSetDefaults() error {
 		errs = append(errs, "missing version info (either fixed or by url)")
 	}
 
+	//SIGNATURE
+	if definition.Signature.Type == "" {
+		definition.Signature.Type = SIGNATURE_MINISIGN
+	} else if definition.Signature.Type != SIGNATURE_MINISIGN && definition.Signature.Type != SIGNATURE_OPENPGP {
+		errs = append(errs, fmt.Sprint("unsupported signature type ", definition.Signature.Type, " (", SIGNATURE_MINISIGN, " or ", SIGNATURE_OPENPGP, ")"))
+	}
+
 	//REGEX
 	if definition.ExtractRegExList == nil || len(definition.ExtractRegExList) == 0 {
 		definition.ExtractRegExList = []string{"(.*)"}
@@ -107,6 +210,13 @@ func (definition *AppDefinition) validateAndSetDefaults() error {
 		definition.extractRegex = regex
 	}
 
+	//PERSIST
+	for _, persisted := range definition.Persist {
+		if !filepath.IsLocal(persisted) {
+			errs = append(errs, fmt.Sprint("persisted path ", persisted, " must be relative to app folder"))
+		}
+	}
+
 	//Version file for easy see in explorer
 	if !definition.NoAddVersionFile {
 		const VersionFile = "VERSION-{{VERSION}}.nomad"
@@ -117,6 +227,35 @@ func (definition *AppDefinition) validateAndSetDefaults() error {
 		}
 	}
 
+	//TEMPLATES (rendered later, when version is known), literal braces are kept without opt-in
+	templates := map[string]string{"DownloadUrl": definition.DownloadUrl, "Checksum": definition.Checksum,
+		"Shortcut": definition.Shortcut, "Signature.Url": definition.Signature.Url}
+	for name, body := range definition.CreateFiles {
+		templates[fmt.Sprint("CreateFiles name ", name)] = name
+		templates[fmt.Sprint("CreateFiles ", name)] = body
+	}
+	//Other platforms too (same definition file on every host)
+	for key, platform := range definition.Platforms {
+		if osName, arch, withArch := strings.Cut(key, "/"); osName == "" || (withArch && (arch == "" || strings.Contains(arch, "/"))) {
+			errs = append(errs, fmt.Sprint("bad platform ", key, " (syntax is os/arch or os, ex: linux/amd64)"))
+		}
+		templates[fmt.Sprint("Platforms ", key, " DownloadUrl")] = platform.DownloadUrl
+		templates[fmt.Sprint("Platforms ", key, " Shortcut")] = platform.Shortcut
+		for name, body := range platform.CreateFiles {
+			templates[fmt.Sprint("Platforms ", key, " CreateFiles name ", name)] = name
+			templates[fmt.Sprint("Platforms ", key, " CreateFiles ", name)] = body
+		}
+	}
+	if definition.Templates {
+		fields := maputil.Keys(templates)
+		sort.Strings(fields)
+		for _, field := range fields {
+			if err := render.Check(templates[field]); err != nil {
+				errs = append(errs, fmt.Sprint("invalid template in ", field, " | ", err))
+			}
+		}
+	}
+
 	if len(errs) > 0 {
 		return errors.New(fmt.Sprint("data errors: ", strings.Join(errs, ",")))
 	} else {
@@ -186,6 +325,10 @@ func (definition *AppDefinition) ComputeDownloadExtension() {
 				lastPoint := strings.LastIndex(definition.DownloadUrl, ".")
 				if lastPoint >= 0 {
 					clean := extensionRegex.FindString(definition.DownloadUrl[lastPoint:])
+					//Compressed tar (.tar.gz...)
+					if strings.HasSuffix(definition.DownloadUrl[:lastPoint], ".tar") {
+						clean = ".tar" + clean
+					}
 					definition.DownloadExtension = clean
 				} else {
 					definition.DownloadExtension = defaultExt
@@ -198,6 +341,34 @@ func (definition *AppDefinition) ComputeDownloadExtension() {
 	}
 }
 
+//goland:noinspection GoSnakeCaseUsage
+const (
+	SIGNATURE_MINISIGN = "minisign"
+	SIGNATURE_OPENPGP  = "openpgp"
+)
+
+// Signature describes how to check a detached signature of the downloaded archive
+type Signature struct {
+	Type      string `json:"Type"`      //minisign (default) or openpgp
+	Url       string `json:"Url"`       //signature url (placeholders allowed), defaults to download url + .minisig/.asc
+	PublicKey string `json:"PublicKey"` //trusted key: minisign public key or armored OpenPGP public key (never fetched from remote)
+}
+
+func (signature Signature) IsSet() bool {
+	return signature.PublicKey != ""
+}
+
+// SignatureUrl returns signature url for given (final) download url
+func (signature Signature) SignatureUrl(downloadURL string) string {
+	if signature.Url != "" {
+		return signature.Url
+	}
+	if signature.Type == SIGNATURE_OPENPGP {
+		return downloadURL + ".asc"
+	}
+	return downloadURL + ".minisig"
+}
+
 type VersionCheck struct {
 	Url              string `json:"Url"`
 	RegEx            string `json:"RegEx"`
@@ -219,6 +390,24 @@ func (vc *VersionCheck) BuildRequest() (url string, response string) {
 	return
 }
 
+// GithubReleaseAsset splits a github release download url (as built by fillInfosFromRepository)
+func GithubReleaseAsset(downloadURL string) (owner string, repo string, tag string, asset string, found bool) {
+	infos, isGithub := strings.CutPrefix(downloadURL, GITHUB_BASE_URL)
+	if !isGithub {
+		return
+	}
+	parts := strings.Split(strings.SplitN(infos, "?", 2)[0], "/")
+	if len(parts) != 6 || parts[2] != "releases" || parts[3] != "download" {
+		return
+	}
+	return parts[0], parts[1], parts[4], parts[5], true
+}
+
+// GithubReleaseRequest returns github api url (apiURL being GITHUB_API_URL) describing a release (with its assets)
+func GithubReleaseRequest(apiURL string, owner string, repo string, tag string) string {
+	return fmt.Sprint(apiURL, "repos/", owner, "/", repo, "/releases/tags/", tag)
+}
+
 // CombineRegex will take a string array of regular expressions and compile them
 // into a single regular expressions
 func combineRegex(s []string) (*regexp.Regexp, error) {
@@ -17,6 +17,9 @@ func TestAppDefinition_ComputeDownloadExtension(t *testing.T) {
 		{name: "standard", fields: fields{DownloadUrl: "http://www.test.com/test.zip"}, result: ".zip"},
 		{name: "githubrepo", fields: fields{DownloadUrl: "test-{{VERSION}}.exe"}, result: ".exe"},
 		{name: "sourceforge", fields: fields{DownloadUrl: "bob.zip/download"}, result: ".zip"},
+		{name: "tar", fields: fields{DownloadUrl: "https://go.dev/dl/go1.21.3.linux-amd64.tar.gz"}, result: ".tar.gz"},
+		{name: "tar sourceforge", fields: fields{DownloadUrl: "bob.tar.xz/download"}, result: ".tar.xz"},
+		{name: "single file", fields: fields{DownloadUrl: "https://example.org/tool-linux-amd64.gz"}, result: ".gz"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -124,3 +127,85 @@ func TestAppDefinition_fillInfosFromRepository(t *testing.T) {
 		})
 	}
 }
+
+func TestGithubReleaseAsset(t *testing.T) {
+	tests := []struct {
+		name        string
+		downloadURL string
+		wantTag     string
+		wantAsset   string
+		wantFound   bool
+	}{
+		{"release asset", "https://github.com/owner/repo/releases/download/v1.2.0/app-1.2.0.zip", "v1.2.0", "app-1.2.0.zip", true},
+		{"with query", "https://github.com/owner/repo/releases/download/v1.2.0/app.zip?raw=1", "v1.2.0", "app.zip", true},
+		{"archive", "https://github.com/owner/repo/archive/refs/tags/v1.2.0.zip", "", "", false},
+		{"other host", "https://example.org/owner/repo/releases/download/v1.2.0/app.zip", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner, repo, tag, asset, found := GithubReleaseAsset(tt.downloadURL)
+			assert.Equal(t, tt.wantFound, found)
+			assert.Equal(t, tt.wantTag, tag)
+			assert.Equal(t, tt.wantAsset, asset)
+			if found {
+				assert.Equal(t, "owner", owner)
+				assert.Equal(t, "repo", repo)
+			}
+		})
+	}
+}
+
+func TestSignatureUrl(t *testing.T) {
+	assert.Equal(t, "https://example.org/app.zip.minisig", Signature{}.SignatureUrl("https://example.org/app.zip"))
+	assert.Equal(t, "https://example.org/app.zip.asc", Signature{Type: SIGNATURE_OPENPGP}.SignatureUrl("https://example.org/app.zip"))
+	assert.Equal(t, "https://example.org/sig", Signature{Url: "https://example.org/sig"}.SignatureUrl("https://example.org/app.zip"))
+}
+
+func TestAppDefinition_validateTemplates(t *testing.T) {
+	definition := AppDefinition{ApplicationName: "app", Version: "1.0", DownloadUrl: "https://example.org/app-{{VERSION}}-{{os}}.zip", Templates: true,
+		CreateFiles: map[string]string{"run.bat": "{{if eq os \"windows\"}}start{{end}} {{APP_PATH}}"}}
+	assert.NoError(t, definition.validateAndSetDefaults())
+
+	definition = AppDefinition{ApplicationName: "app", Version: "1.0", DownloadUrl: "https://example.org/app-{{VERSIN}}.zip", Templates: true}
+	assert.ErrSubMsg(t, definition.validateAndSetDefaults(), "invalid template in DownloadUrl")
+
+	//Literal braces are fine without opt-in
+	definition = AppDefinition{ApplicationName: "app", Version: "1.0", DownloadUrl: "https://example.org/app-{{VERSION}}.zip",
+		CreateFiles: map[string]string{"config.json": `{"template": "{{ name }}"}`}}
+	assert.NoError(t, definition.validateAndSetDefaults())
+}
+
+func TestAppDefinition_applyPlatform(t *testing.T) {
+	base := func() AppDefinition {
+		return AppDefinition{ApplicationName: "app", DownloadUrl: "https://example.org/app.7z", DownloadExtension: ".zip", Shortcut: "app.exe",
+			Platforms: map[string]Platform{
+				"linux/amd64": {DownloadUrl: "https://example.org/app-linux-amd64.tar.gz", Shortcut: "bin/app"},
+				"linux":       {DownloadUrl: "https://example.org/app-linux.zip", ExtractRegExList: []string{"bin/.*"}},
+				"darwin":      {DownloadExtension: ".dmg", CreateFiles: map[string]string{"run.sh": "./app"}},
+			}}
+	}
+	tests := []struct {
+		platform      string
+		wantUrl       string
+		wantExtension string
+		wantShortcut  string
+	}{
+		{"windows/amd64", "https://example.org/app.7z", ".zip", "app.exe"},
+		{"linux/amd64", "https://example.org/app-linux-amd64.tar.gz", "", "bin/app"}, //extension guessed again later
+		{"linux/arm64", "https://example.org/app-linux.zip", "", "app.exe"},
+		{"darwin/arm64", "https://example.org/app.7z", ".dmg", "app.exe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			definition := base()
+			definition.applyPlatform(tt.platform)
+			assert.Equal(t, tt.wantUrl, definition.DownloadUrl)
+			assert.Equal(t, tt.wantExtension, definition.DownloadExtension)
+			assert.Equal(t, tt.wantShortcut, definition.Shortcut)
+		})
+	}
+
+	definition := base()
+	definition.Platforms["linux/"] = Platform{}
+	assert.ErrSubMsg(t, definition.validateAndSetDefaults(), "bad platform linux/")
+}
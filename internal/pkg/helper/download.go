@@ -0,0 +1,235 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gologme/log"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Retries of a failed download (5xx, connection reset, idle timeout...), with exponential backoff
+var (
+	DownloadRetries = 4
+	RetryDelay      = 2 * time.Second
+)
+
+const partialSuffix = ".part"
+
+// validatorSuffix names the file (next to partial one) keeping ETag/Last-Modified of partial data, sent as If-Range
+const validatorSuffix = ".validator"
+
+// retryableError marks a transient failure
+type retryableError struct {
+	error
+}
+
+func (err retryableError) Unwrap() error {
+	return err.error
+}
+
+// DownloadFile downloads a file from a URL
+// Data is written to fileName.part (resumed with http Range if a previous attempt was interrupted, as long as the
+// server content did not change, see If-Range) which is renamed to fileName once complete,
+// thus a canceled download is never taken for a complete file
+func DownloadFile(ctx context.Context, logger *log.Logger, url string, fileName string, ignoreBadCert bool) (int64, error) {
+	partialFileName := fileName + partialSuffix
+
+	var err error
+	for attempt := 0; attempt <= DownloadRetries; attempt++ {
+		if attempt > 0 {
+			delay := RetryDelay * time.Duration(1<<(attempt-1))
+			logger.Warnln("Download interrupted (", err, "), retry", attempt, "/", DownloadRetries, "in", delay)
+			select {
+			case <-ctx.Done():
+				return -1, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		err = downloadPartialFile(ctx, logger, url, partialFileName, ignoreBadCert)
+		if err == nil {
+			if err := os.Rename(partialFileName, fileName); err != nil {
+				return -1, err
+			}
+			if err := os.Remove(partialFileName + validatorSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				logger.Warnln("Cannot remove", partialFileName+validatorSuffix, "|", err)
+			}
+			return Size(fileName), nil
+		} else if ctx.Err() != nil {
+			return -1, ctx.Err()
+		} else if !isRetryable(err) {
+			return -1, err
+		}
+	}
+	return -1, err
+}
+
+// downloadPartialFile appends missing data to partialFileName
+// Partial data is only resumed if its validator is known, the server sends everything again if content changed
+func downloadPartialFile(ctx context.Context, logger *log.Logger, url string, partialFileName string, ignoreBadCert bool) error {
+	validatorFileName := partialFileName + validatorSuffix
+	var offset int64
+	var ifRange string
+	if info, err := os.Stat(partialFileName); err == nil && info.Size() > 0 {
+		if content, err := os.ReadFile(validatorFileName); err == nil && len(content) > 0 {
+			offset = info.Size()
+			ifRange = string(content)
+		} else {
+			logger.Debugln("Cannot resume download of", partialFileName, "(unknown content version), starting again")
+		}
+	}
+
+	request, err := newRequest(ctx, url, "GET")
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		logger.Debugln("Resuming download of", partialFileName, "at", offset)
+		request.Header.Set("Range", fmt.Sprint("bytes=", offset, "-"))
+		request.Header.Set("If-Range", ifRange)
+	}
+
+	response, err := doHttp(request, ignoreBadCert)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			logger.Errorln("Cannot close http body", err)
+		}
+	}(response.Body)
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case response.StatusCode == http.StatusPartialContent && rangeStart(response.Header.Get("Content-Range")) == offset:
+		flags |= os.O_APPEND
+	case response.StatusCode == http.StatusOK:
+		//Range not supported, content changed (If-Range) or no previous data, start again
+		offset = 0
+		flags |= os.O_TRUNC
+		if err := writeValidator(validatorFileName, response); err != nil {
+			return err
+		}
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && rangeTotal(response.Header.Get("Content-Range")) == offset:
+		//Partial file already complete
+		return nil
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable, response.StatusCode == http.StatusPartialContent:
+		//Range not at offset
+		if err := os.Remove(partialFileName); err != nil {
+			return err
+		}
+		if err := os.Remove(validatorFileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return retryableError{errors.New("cannot resume download, starting again")}
+	case response.StatusCode == http.StatusNotFound:
+		return errors.New("URL not found")
+	case response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests:
+		return retryableError{errors.New(fmt.Sprint("Bad http status: ", response.StatusCode))}
+	default:
+		return errors.New(fmt.Sprint("Bad http status: ", response.StatusCode))
+	}
+
+	out, err := os.OpenFile(partialFileName, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer func(out *os.File) {
+		err := out.Close()
+		if err != nil {
+			logger.Errorln("Cannot close", partialFileName, "|", err)
+		}
+	}(out)
+
+	total := int64(-1)
+	if response.ContentLength >= 0 {
+		total = offset + response.ContentLength
+	}
+	progress := newProgress(logger, strings.TrimSuffix(filepath.Base(partialFileName), partialSuffix), offset, total)
+	written, err := io.Copy(io.MultiWriter(out, progress), response.Body)
+	progress.done()
+	if err != nil {
+		return err
+	}
+	if response.ContentLength >= 0 && written < response.ContentLength {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// writeValidator keeps the strong ETag (else Last-Modified) of response, to resume only the same content (If-Range)
+func writeValidator(validatorFileName string, response *http.Response) error {
+	validator := response.Header.Get("Last-Modified")
+	if etag := response.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") /*weak ones are refused by If-Range*/ {
+		validator = etag
+	}
+	if validator == "" {
+		if err := os.Remove(validatorFileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(validatorFileName, []byte(validator), 0644)
+}
+
+// rangeStart returns first byte position from a Content-Range header (bytes 10-35/36), -1 if unknown
+func rangeStart(contentRange string) int64 {
+	positions, found := strings.CutPrefix(contentRange, "bytes ")
+	if !found {
+		return -1
+	}
+	startText, _, found := strings.Cut(positions, "-")
+	if !found {
+		return -1
+	}
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// rangeTotal returns total size from a Content-Range header (bytes */1234), -1 if unknown
+func rangeTotal(contentRange string) int64 {
+	_, totalText, found := strings.Cut(contentRange, "/")
+	if !found {
+		return -1
+	}
+	total, err := strconv.ParseInt(totalText, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
+
+// Connection errors worth a retry (winsock ones differ from syscall.ECONNRESET/ECONNREFUSED on windows)
+var retryableErrnos = []syscall.Errno{syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.Errno(10054) /*WSAECONNRESET*/, syscall.Errno(10061) /*WSAECONNREFUSED*/}
+
+// isRetryable tells if err is transient: 5xx, timeouts, connection reset/refused, truncated body
+// Others (tls/certificate, unknown host, permission...) would fail the same way again
+func isRetryable(err error) bool {
+	var retryable retryableError
+	var netError net.Error
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &retryable), errors.Is(err, errIdleTimeout), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.As(err, &netError) && netError.Timeout():
+		return true
+	case errors.As(err, &errno):
+		return slices.Contains(retryableErrnos, errno)
+	default:
+		return false
+	}
+}
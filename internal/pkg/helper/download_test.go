@@ -0,0 +1,262 @@
+package helper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/gookit/goutil/testutil/assert"
+	"io"
+	stdlog "log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const downloadContent = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+func init() {
+	RetryDelay = time.Millisecond
+}
+
+// serveVersioned serves content with an ETag, requests Range and If-Range headers are kept
+func serveVersioned(t *testing.T, etag string, content string, headers *[]string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*headers = append(*headers, fmt.Sprint(r.Header.Get("Range"), "|", r.Header.Get("If-Range")))
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "app.zip", time.Time{}, strings.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	var headers []string
+	url := serveVersioned(t, `"v1"`, downloadContent, &headers)
+
+	fileName := filepath.Join(t.TempDir(), "app.zip")
+	assert.NoErr(t, os.WriteFile(fileName+partialSuffix, []byte(downloadContent[:10]), 0644))
+	assert.NoErr(t, os.WriteFile(fileName+partialSuffix+validatorSuffix, []byte(`"v1"`), 0644))
+
+	size, err := DownloadFile(context.Background(), log.Default(), url, fileName, false)
+
+	assert.NoErr(t, err)
+	assert.Eq(t, int64(len(downloadContent)), size)
+	assert.Eq(t, []string{`bytes=10-|"v1"`}, headers)
+	content, _ := os.ReadFile(fileName)
+	assert.Eq(t, downloadContent, string(content))
+	assert.False(t, FileOrDirExists(fileName+partialSuffix))
+	assert.False(t, FileOrDirExists(fileName+partialSuffix+validatorSuffix))
+}
+
+func TestDownloadFileResumeChangedContent(t *testing.T) {
+	var headers []string
+	changed := strings.ToUpper(downloadContent)
+	url := serveVersioned(t, `"v2"`, changed, &headers)
+
+	fileName := filepath.Join(t.TempDir(), "app.zip")
+	assert.NoErr(t, os.WriteFile(fileName+partialSuffix, []byte(downloadContent[:10]), 0644))
+	assert.NoErr(t, os.WriteFile(fileName+partialSuffix+validatorSuffix, []byte(`"v1"`), 0644))
+
+	_, err := DownloadFile(context.Background(), log.Default(), url, fileName, false)
+
+	assert.NoErr(t, err)
+	assert.Eq(t, []string{`bytes=10-|"v1"`}, headers) //200, whole new content
+	content, _ := os.ReadFile(fileName)
+	assert.Eq(t, changed, string(content))
+}
+
+func TestDownloadFileResumeUnknownVersion(t *testing.T) {
+	var headers []string
+	url := serveVersioned(t, `"v1"`, downloadContent, &headers)
+
+	//Left by an interrupted download without validator
+	fileName := filepath.Join(t.TempDir(), "app.zip")
+	assert.NoErr(t, os.WriteFile(fileName+partialSuffix, []byte("stale data"), 0644))
+
+	_, err := DownloadFile(context.Background(), log.Default(), url, fileName, false)
+
+	assert.NoErr(t, err)
+	assert.Eq(t, []string{"|"}, headers) //not resumed
+	content, _ := os.ReadFile(fileName)
+	assert.Eq(t, downloadContent, string(content))
+}
+
+func TestDownloadFileAlreadyComplete(t *testing.T) {
+	var headers []string
+	url := serveVersioned(t, `"v1"`, downloadContent, &headers)
+
+	fileName := filepath.Join(t.TempDir(), "app.zip")
+	assert.NoErr(t, os.WriteFile(fileName+partialSuffix, []byte(downloadContent), 0644))
+	assert.NoErr(t, os.WriteFile(fileName+partialSuffix+validatorSuffix, []byte(`"v1"`), 0644))
+
+	size, err := DownloadFile(context.Background(), log.Default(), url, fileName, false)
+
+	assert.NoErr(t, err)
+	assert.Eq(t, int64(len(downloadContent)), size)
+	assert.Eq(t, 1, len(headers))
+}
+
+func TestDownloadFileRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			//truncated response
+			w.Header().Set("Content-Length", fmt.Sprint(len(downloadContent)))
+			_, _ = w.Write([]byte(downloadContent[:5]))
+		default:
+			http.ServeContent(w, r, "app.zip", time.Time{}, strings.NewReader(downloadContent))
+		}
+	}))
+	defer server.Close()
+
+	fileName := filepath.Join(t.TempDir(), "app.zip")
+	_, err := DownloadFile(context.Background(), log.Default(), server.URL, fileName, false)
+
+	assert.NoErr(t, err)
+	assert.Eq(t, 3, calls)
+	content, _ := os.ReadFile(fileName)
+	assert.Eq(t, downloadContent, string(content))
+}
+
+func TestDownloadFileNotFound(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := DownloadFile(context.Background(), log.Default(), server.URL, filepath.Join(t.TempDir(), "app.zip"), false)
+
+	assert.ErrMsg(t, err, "URL not found")
+	assert.Eq(t, 1, calls)
+}
+
+func TestDownloadFileBadCertificate(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "app.zip", time.Time{}, strings.NewReader(downloadContent))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Config.ErrorLog = stdlog.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	_, err := DownloadFile(context.Background(), log.Default(), server.URL, filepath.Join(t.TempDir(), "app.zip"), false)
+
+	assert.ErrSubMsg(t, err, "certificate")
+	assert.Eq(t, int32(1), connections.Load())
+}
+
+func Test_isRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", retryableError{errors.New("Bad http status: 503")}, true},
+		{"idle timeout", errIdleTimeout, true},
+		{"truncated body", fmt.Errorf("read body | %w", io.ErrUnexpectedEOF), true},
+		{"dial timeout", &url.Error{Op: "Get", URL: "https://example.org", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}}, true},
+		{"connection reset", &url.Error{Op: "Get", URL: "https://example.org", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{"winsock connection reset", &net.OpError{Op: "wsarecv", Net: "tcp", Err: os.NewSyscallError("wsarecv", syscall.Errno(10054))}, true},
+		{"unknown authority", &url.Error{Op: "Get", URL: "https://example.org", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, false},
+		{"bad hostname", &url.Error{Op: "Get", URL: "https://example.org", Err: x509.HostnameError{Certificate: &x509.Certificate{}, Host: "example.org"}}, false},
+		{"tls alert", &net.OpError{Op: "remote error", Err: tls.AlertError(40)}, false},
+		{"no such host", &url.Error{Op: "Get", URL: "https://example.invalid", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}}}, false},
+		{"permission denied", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.EACCES)}, false},
+		{"file permission", &os.PathError{Op: "open", Path: "app.zip.part", Err: os.ErrPermission}, false},
+		{"not found", errors.New("URL not found"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Eq(t, tt.want, isRetryable(tt.err))
+		})
+	}
+}
+
+func TestDownloadFileIdleTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { IdleTimeout = timeout }(IdleTimeout)
+	IdleTimeout = 50 * time.Millisecond
+	defer func(retries int) { DownloadRetries = retries }(DownloadRetries)
+	DownloadRetries = 1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(downloadContent)))
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		_, _ = w.Write([]byte(downloadContent[:5]))
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	_, err := DownloadFile(context.Background(), log.Default(), server.URL, filepath.Join(t.TempDir(), "app.zip"), false)
+
+	assert.ErrIs(t, err, errIdleTimeout)
+}
+
+func TestDownloadFileCanceled(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.zip")
+	ctx, cancel := context.WithCancel(context.Background())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(downloadContent)))
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		_, _ = w.Write([]byte(downloadContent[:5]))
+		w.(http.Flusher).Flush()
+		//Canceled (ctrl-c) once first bytes are written
+		for Size(fileName+partialSuffix) < 5 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	_, err := DownloadFile(ctx, log.Default(), server.URL, fileName, false)
+
+	assert.ErrIs(t, err, context.Canceled)
+	assert.False(t, FileOrDirExists(fileName)) //only the partial file is left (resumed next time)
+	content, _ := os.ReadFile(fileName + partialSuffix)
+	assert.Eq(t, downloadContent[:5], string(content))
+	validator, _ := os.ReadFile(fileName + partialSuffix + validatorSuffix)
+	assert.Eq(t, "Mon, 02 Jan 2006 15:04:05 GMT", string(validator))
+}
+
+func TestProgressLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		current int64
+		total   int64
+		speed   float64
+		want    string
+	}{
+		{"unknown size", 2048, -1, 1024, "app.zip 2.00 KB 1.00 KB/s"},
+		{"half", 50, 100, 10, "app.zip [============>            ]  50% 50.00 B/100.00 B 10.00 B/s ETA 5s"},
+		{"done", 100, 100, 10, "app.zip [=========================] 100% 100.00 B/100.00 B 10.00 B/s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Eq(t, tt.want, progressLine("app.zip", tt.current, tt.total, tt.speed))
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package helper
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gologme/log"
@@ -9,8 +11,8 @@ import (
 	"github.com/jonathanMelly/nomad/pkg/bytesize"
 	"github.com/jonathanMelly/nomad/pkg/version"
 	"io"
+	"net"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 )
@@ -19,9 +21,9 @@ const USER_AGENT_BROWSER = `Mozilla/5.0 (Macintosh; Intel Mac OS X 10_7_5) Apple
 const USER_AGENT_WGET = `curl/7.54`
 
 // GetVersion will return extracted text from a page at a URL
-func GetVersion(url string, definition *data.AppDefinition, apiKey string, requestBody string) (*version.Version, error) {
+func GetVersion(ctx context.Context, url string, definition *data.AppDefinition, apiKey string, requestBody string) (*version.Version, error) {
 
-	responseBody, err := sendRequest(url, apiKey, requestBody)
+	responseBody, err := sendRequest(ctx, url, apiKey, requestBody)
 	if err != nil {
 		return nil, err
 	}
@@ -34,9 +36,32 @@ func GetVersion(url string, definition *data.AppDefinition, apiKey string, reque
 	return foundVersion, nil
 }
 
+// GetGithubReleaseAssets returns assets names of a github release (see data.GithubReleaseRequest)
+func GetGithubReleaseAssets(ctx context.Context, releaseURL string, apiKey string) ([]string, error) {
+	responseBody, err := sendRequest(ctx, releaseURL, apiKey, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var release struct {
+		Assets []struct {
+			Name string `json:"name"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal([]byte(responseBody), &release); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, asset := range release.Assets {
+		names = append(names, asset.Name)
+	}
+	return names, nil
+}
+
 // TODO refactor with BuildAndDoHttp !!!
 // sendRequest returns the request response body
-func sendRequest(url string, apiKey string, requestBody string) (string, error) {
+func sendRequest(ctx context.Context, url string, apiKey string, requestBody string) (string, error) {
 
 	var method string
 	if requestBody != "" {
@@ -45,7 +70,7 @@ func sendRequest(url string, apiKey string, requestBody string) (string, error)
 		method = "GET"
 	}
 
-	r, err := http.NewRequest(method, url, strings.NewReader(requestBody))
+	r, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(requestBody))
 	if err != nil {
 		return "", err
 	}
@@ -79,46 +104,55 @@ func sendRequest(url string, apiKey string, requestBody string) (string, error)
 	}
 
 	log.Traceln("received", bytesize.ByteSize(len(body) /*do not trust client.ContentLength...*/))
+	if client.StatusCode < 200 || client.StatusCode > 299 {
+		return "", errors.New(fmt.Sprint("Bad http status: ", client.StatusCode, " for ", url))
+	}
 	return string(body), nil
 }
 
-// DownloadFile downloads a file from a URL
-func DownloadFile(url string, fileName string, ignoreBadCert bool) (int64, error) {
-	out, err := os.Create(fileName)
-	defer func(out *os.File) {
-		err := out.Close()
-		if err != nil {
-			log.Errorln("Cannot close", fileName, "|", err)
-		}
-	}(out)
-	if err != nil {
-		return 0, err
-	}
-
-	response, err := BuildAndDoHttp(url, "GET", ignoreBadCert)
+// DownloadText returns the (small) text content of a URL
+func DownloadText(ctx context.Context, url string, ignoreBadCert bool) (string, error) {
+	response, err := BuildAndDoHttp(ctx, url, "GET", ignoreBadCert)
 	if err != nil {
-		return -1, err
+		return "", err
 	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			log.Errorln("Cannot close http body", err)
+		}
+	}(response.Body)
 
 	switch response.StatusCode {
 	case 200:
-		defer func(Body io.ReadCloser) {
-			err := Body.Close()
-			if err != nil {
-				log.Errorln("Cannot close http body", err)
-			}
-		}(response.Body)
-		n, err := io.Copy(out, response.Body)
-		return n, err
+		const maxTextSize = 1 << 20
+		body, err := io.ReadAll(io.LimitReader(response.Body, maxTextSize))
+		return string(body), err
 	case 404:
-		return -1, errors.New("URL not found")
+		return "", errors.New("URL not found")
 	default:
-		return -1, errors.New(fmt.Sprint("Bad http status: ", response.StatusCode))
+		return "", errors.New(fmt.Sprint("Bad http status: ", response.StatusCode))
+	}
+}
+
+// Timeouts of http requests (no total timeout as big downloads on slow links may take long)
+var (
+	ConnectTimeout = 15 * time.Second //dial and tls handshake
+	IdleTimeout    = 30 * time.Second //max wait for response headers and between 2 received chunks
+)
+
+var errIdleTimeout = errors.New("idle timeout (no data received)")
+
+func BuildAndDoHttp(ctx context.Context, url string, method string, ignoreBadCert bool) (*http.Response, error) {
+	r, err := newRequest(ctx, url, method)
+	if err != nil {
+		return nil, err
 	}
+	return doHttp(r, ignoreBadCert)
 }
 
-func BuildAndDoHttp(url string, method string, ignoreBadCert bool) (*http.Response, error) {
-	r, err := http.NewRequest(method, url, nil)
+func newRequest(ctx context.Context, url string, method string) (*http.Request, error) {
+	r, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -130,20 +164,56 @@ func BuildAndDoHttp(url string, method string, ignoreBadCert bool) (*http.Respon
 		userAgent = USER_AGENT_WGET
 	}
 	r.Header.Add("User-Agent", userAgent)
+	return r, nil
+}
 
+// doHttp sends request with connect/idle timeouts (response body read is canceled if idle for too long)
+func doHttp(r *http.Request, ignoreBadCert bool) (*http.Response, error) {
 	if ignoreBadCert {
-		log.Debugln("ignoring bad cert for this url:", url)
+		log.Debugln("ignoring bad cert for this url:", r.URL)
 	}
-	transport := http.DefaultTransport.(*http.Transport)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = ConnectTimeout
+	transport.ResponseHeaderTimeout = IdleTimeout
 	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: ignoreBadCert}
 	httpClient := http.Client{
-		Timeout:   10 * time.Second,
 		Transport: transport,
 	}
 
-	response, err := httpClient.Do(r)
+	ctx, cancel := context.WithCancelCause(r.Context())
+	response, err := httpClient.Do(r.WithContext(ctx))
 	if err != nil {
+		cancel(err)
 		return nil, err
 	}
+	response.Body = &idleTimeoutBody{
+		ReadCloser: response.Body,
+		ctx:        ctx,
+		cancel:     cancel,
+		timer:      time.AfterFunc(IdleTimeout, func() { cancel(errIdleTimeout) }),
+	}
 	return response, nil
 }
+
+type idleTimeoutBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	timer  *time.Timer
+}
+
+func (body *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if err != nil && errors.Is(context.Cause(body.ctx), errIdleTimeout) {
+		return n, errIdleTimeout
+	}
+	body.timer.Reset(IdleTimeout)
+	return n, err
+}
+
+func (body *idleTimeoutBody) Close() error {
+	body.timer.Stop()
+	defer body.cancel(nil)
+	return body.ReadCloser.Close()
+}
@@ -0,0 +1,28 @@
+package helper
+
+import (
+	"context"
+	"github.com/gookit/goutil/testutil/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetGithubReleaseAssets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/limited" {
+			http.Error(w, `{"message":"API rate limit exceeded"}`, http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"assets":[{"name":"app.zip"},{"name":"SHA256SUMS"}]}`))
+	}))
+	defer server.Close()
+
+	assets, err := GetGithubReleaseAssets(context.Background(), server.URL+"/release", "")
+	assert.NoError(t, err)
+	assert.Eq(t, []string{"app.zip", "SHA256SUMS"}, assets)
+
+	assets, err = GetGithubReleaseAssets(context.Background(), server.URL+"/limited", "")
+	assert.ErrSubMsg(t, err, "403")
+	assert.Empty(t, assets)
+}
@@ -1,10 +1,15 @@
 package helper
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"github.com/gologme/log"
+	"hash"
+	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
 )
 
 func stat(path string) os.FileInfo {
@@ -68,3 +73,47 @@ func IsSymlink(path string) bool {
 	}
 	return isSymlink
 }
+
+// Size returns the size of a file or the total size of a directory content
+func Size(path string) int64 {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Debugln("Cannot compute size of", path, "|", err)
+	}
+	return size
+}
+
+// FileHash returns hex encoded hash of file content
+func FileHash(path string, hasher hash.Hash) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			log.Errorln("Cannot close", path, "|", err)
+		}
+	}(file)
+
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Sha256 returns hex encoded sha256 of file content
+func Sha256(path string) (string, error) {
+	return FileHash(path, sha256.New())
+}
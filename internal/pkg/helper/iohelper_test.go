@@ -1,6 +1,10 @@
 package helper
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestFileOrDirExists(t *testing.T) {
 	type args struct {
@@ -23,3 +27,17 @@ func TestFileOrDirExists(t *testing.T) {
 		})
 	}
 }
+
+func TestSha256(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "abc")
+	if err := os.WriteFile(file, []byte("abc"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Sha256(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; got != want {
+		t.Errorf("Sha256() = %v, want %v", got, want)
+	}
+}
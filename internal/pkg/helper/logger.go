@@ -0,0 +1,25 @@
+package helper
+
+import (
+	"github.com/gologme/log"
+	"io"
+)
+
+var logLevels = []string{"panic", "fatal", "error", "warn", "info", "debug", "trace"}
+
+// NewAppLogger returns a logger prefixed with app name, with same flags and levels as standard logger
+// (avoids mixing prefixes when apps are processed concurrently)
+func NewAppLogger(app string, out io.Writer) *log.Logger {
+	logger := log.New(out, BuildPrefix(app), log.Flags())
+	for _, level := range logLevels {
+		if log.GetLevel(level) {
+			logger.EnableLevel(level)
+		}
+	}
+	return logger
+}
+
+// IsLive tells if logger output is shown immediately (not buffered to be grouped with other lines of an app)
+func IsLive(logger *log.Logger) bool {
+	return logger.Writer() == log.Writer()
+}
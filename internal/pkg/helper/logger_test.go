@@ -0,0 +1,24 @@
+package helper
+
+import (
+	"bytes"
+	"github.com/gologme/log"
+	"github.com/gookit/goutil/testutil/assert"
+	"testing"
+)
+
+func TestNewAppLogger(t *testing.T) {
+	log.EnableLevelsByNumber(4)
+	defer log.DisableLevel("info")
+	defer log.SetFlags(log.Flags())
+	log.SetFlags(log.Lmsgprefix)
+
+	output := &bytes.Buffer{}
+	logger := NewAppLogger("app", output)
+	logger.Infoln("hello")
+	logger.Debugln("hidden")
+
+	assert.Eq(t, "|app| hello\n", output.String())
+	assert.False(t, IsLive(logger))
+	assert.True(t, IsLive(NewAppLogger("app", log.Writer())))
+}
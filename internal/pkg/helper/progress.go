@@ -0,0 +1,89 @@
+package helper
+
+import (
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/pkg/bytesize"
+	"golang.org/x/term"
+	"os"
+	"strings"
+	"time"
+)
+
+const progressRefresh = 250 * time.Millisecond
+const progressBarWidth = 25
+
+// progress shows download size, speed and ETA on stderr (only if it is a terminal and logs are live)
+type progress struct {
+	name      string
+	current   int64
+	initial   int64 //resumed data
+	total     int64 //-1 if unknown
+	start     time.Time
+	lastPrint time.Time
+	enabled   bool
+}
+
+func newProgress(logger *log.Logger, name string, initial int64, total int64) *progress {
+	return &progress{
+		name:    name,
+		current: initial,
+		initial: initial,
+		total:   total,
+		start:   time.Now(),
+		enabled: IsLive(logger) && term.IsTerminal(int(os.Stderr.Fd())), //a bar would mix with other apps output
+	}
+}
+
+func (progress *progress) Write(p []byte) (int, error) {
+	progress.current += int64(len(p))
+	if progress.enabled && time.Since(progress.lastPrint) >= progressRefresh {
+		progress.print()
+	}
+	return len(p), nil
+}
+
+func (progress *progress) done() {
+	if progress.enabled {
+		progress.print()
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func (progress *progress) print() {
+	progress.lastPrint = time.Now()
+	elapsed := time.Since(progress.start)
+	var speed float64
+	if elapsed > 0 {
+		speed = float64(progress.current-progress.initial) / elapsed.Seconds()
+	}
+	fmt.Fprintf(os.Stderr, "\r%-100s", progressLine(progress.name, progress.current, progress.total, speed))
+}
+
+// progressLine renders: name [=====>    ] 45% 12.00 MB/26.67 MB 2.00 MB/s ETA 7s
+func progressLine(name string, current int64, total int64, speed float64) string {
+	line := strings.Builder{}
+	line.WriteString(name)
+
+	if total > 0 {
+		ratio := float64(current) / float64(total)
+		if ratio > 1 {
+			ratio = 1
+		}
+		filled := int(ratio * progressBarWidth)
+		bar := strings.Repeat("=", filled)
+		if filled < progressBarWidth {
+			bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+		}
+		line.WriteString(fmt.Sprintf(" [%s] %3d%% %v/%v", bar, int(ratio*100), bytesize.ByteSize(current), bytesize.ByteSize(total)))
+	} else {
+		line.WriteString(fmt.Sprint(" ", bytesize.ByteSize(current)))
+	}
+
+	line.WriteString(fmt.Sprint(" ", bytesize.ByteSize(speed), "/s"))
+	if total > 0 && speed > 0 && current < total {
+		eta := time.Duration(float64(total-current) / speed * float64(time.Second))
+		line.WriteString(fmt.Sprint(" ETA ", eta.Round(time.Second)))
+	}
+	return line.String()
+}
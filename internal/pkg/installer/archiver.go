@@ -2,8 +2,10 @@ package installer
 
 import (
 	"archive/zip"
+	"context"
 	"errors"
 	"fmt"
+	"github.com/bodgit/sevenzip"
 	"github.com/briandowns/spinner"
 	"github.com/gologme/log"
 	"github.com/jonathanMelly/nomad/internal/pkg/data"
@@ -12,13 +14,18 @@ import (
 	"io/fs"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"time"
 )
 
-func extractArchive(archivePath string, definition data.AppDefinition, appTargetDirectory string) error {
+// errInvalidArchive is returned when an archive cannot be read (corrupted download...)
+var errInvalidArchive = errors.New("invalid archive")
+
+func extractArchive(ctx context.Context, logger *log.Logger, archivePath string, definition data.AppDefinition, appTargetDirectory string) error {
 
 	var archiveFileSystem fs.FS
 	switch definition.DownloadExtension {
@@ -26,14 +33,14 @@ func extractArchive(archivePath string, definition data.AppDefinition, appTarget
 		//Simple copyFile/paste for exe files
 		originalAssetName := filepath.Base(definition.DownloadUrl)
 
-		if err := copyFile(archivePath, filepath.Join(appTargetDirectory, originalAssetName)); err != nil {
+		if err := copyFile(logger, archivePath, filepath.Join(appTargetDirectory, originalAssetName)); err != nil {
 			return err
 		} else {
 			//Not an archive, bypass archive handling
 			return nil
 		}
 	case ".zip", ".nupkg":
-		log.Debugln(definition.DownloadExtension, "archive")
+		logger.Debugln(definition.DownloadExtension, "archive")
 		zipReader, err := zip.OpenReader(archivePath)
 		if err != nil {
 			return err
@@ -41,20 +48,31 @@ func extractArchive(archivePath string, definition data.AppDefinition, appTarget
 		defer func(zipReader *zip.ReadCloser) {
 			err := zipReader.Close()
 			if err != nil {
-				log.Warnln("Cannot close zipReader", err)
+				logger.Warnln("Cannot close zipReader", err)
 			}
 		}(zipReader)
 		archiveFileSystem = zipReader
-	case ".7sfx":
-		//Simple autoextract sfx
-		cmd := exec.Command(archivePath, "-o"+appTargetDirectory, "-y")
-		//TODO filter regex
-		if err := cmd.Run(); err != nil {
-			return err
-		} else {
-			//Not an archive, bypass archive handling
-			return nil
+	case ".tar", ".tar.gz", ".tgz", ".tar.xz", ".txz", ".tar.bz2", ".tbz2", ".tbz", ".tar.zst", ".tzst":
+		logger.Debugln(definition.DownloadExtension, "archive")
+		return extractTar(ctx, logger, archivePath, tarCompressions[definition.DownloadExtension], appTargetDirectory, definition.GetExtractRegex())
+	case ".gz", ".xz", ".bz2", ".zst":
+		//Single compressed file (not an archive), named after downloaded asset
+		assetName := strings.TrimSuffix(path.Base(strings.Split(definition.DownloadUrl, "?")[0]), definition.DownloadExtension)
+		return decompressFile(ctx, logger, archivePath, definition.DownloadExtension, filepath.Join(appTargetDirectory, assetName))
+	case ".7z", ".7sfx":
+		//Self-extracting archives are opened too (7z payload is found after the sfx stub), never executed
+		logger.Debugln(definition.DownloadExtension, "archive")
+		sevenZipReader, err := sevenzip.OpenReader(archivePath)
+		if err != nil {
+			return errors.Join(errInvalidArchive, err)
 		}
+		defer func(sevenZipReader *sevenzip.ReadCloser) {
+			err := sevenZipReader.Close()
+			if err != nil {
+				logger.Warnln("Cannot close 7z reader", err)
+			}
+		}(sevenZipReader)
+		archiveFileSystem = sevenZipReader
 
 	case ".ahksetup":
 
@@ -70,7 +88,7 @@ func extractArchive(archivePath string, definition data.AppDefinition, appTarget
 		absOriginal, _ := filepath.Abs(original)
 		absAppTargetDirectory, _ := filepath.Abs(appTargetDirectory)
 
-		cmd := exec.Command(absOriginal, "/S", "/D="+absAppTargetDirectory)
+		cmd := exec.CommandContext(ctx, absOriginal, "/S", "/D="+absAppTargetDirectory)
 		//TODO filter regex
 		if err := cmd.Run(); err != nil {
 			err2 := os.Rename(original, archivePath)
@@ -97,12 +115,12 @@ func extractArchive(archivePath string, definition data.AppDefinition, appTarget
 		return err
 	}
 
-	log.Debugln("Deepest root in archive:", archiveDeepestRootFolder)
-	return copyFromFS(archiveFileSystem, archiveDeepestRootFolder, appTargetDirectory, definition.GetExtractRegex())
+	logger.Debugln("Deepest root in archive:", archiveDeepestRootFolder)
+	return copyFromFS(ctx, logger, archiveFileSystem, archiveDeepestRootFolder, appTargetDirectory, definition.GetExtractRegex())
 
 }
 
-func copyFile(sourcePath string, destinationPath string) error {
+func copyFile(logger *log.Logger, sourcePath string, destinationPath string) error {
 	source, err := os.Open(sourcePath)
 	if err != nil {
 		return err
@@ -110,7 +128,7 @@ func copyFile(sourcePath string, destinationPath string) error {
 	defer func(source *os.File) {
 		err := source.Close()
 		if err != nil {
-			log.Errorln("Cannot close", sourcePath, "reader")
+			logger.Errorln("Cannot close", sourcePath, "reader")
 		}
 	}(source)
 	//Creates file directory
@@ -127,7 +145,7 @@ func copyFile(sourcePath string, destinationPath string) error {
 	defer func(target *os.File) {
 		err := target.Close()
 		if err != nil {
-			log.Errorln("Cannot close", target.Name())
+			logger.Errorln("Cannot close", target.Name())
 		}
 	}(target)
 
@@ -139,17 +157,14 @@ func copyFile(sourcePath string, destinationPath string) error {
 }
 
 // copyFromFS will copyFromFS certain files from a fs to a target based on a regular expression
-func copyFromFS(sourceFileSystem fs.FS, root string, targetDirectory string, allowRegExp *regexp.Regexp) error {
+// Paths escaping targetDirectory are rejected, modes (not on windows), times and inner symlinks are kept
+func copyFromFS(ctx context.Context, logger *log.Logger, sourceFileSystem fs.FS, root string, targetDirectory string, allowRegExp *regexp.Regexp) error {
 
-	log.Infoln("Extracting files from archive")
-	s := spinner.New(spinner.CharSets[59], 300*time.Millisecond)
-	s.Prefix = "Please wait while extracting "
-	s.Start()
-	defer s.Stop()
+	defer extracting(logger)()
 
 	// Create folder to copyFromFS files
 	if !helper.FileOrDirExists(targetDirectory) {
-		log.Debugln("Creating", targetDirectory)
+		logger.Debugln("Creating", targetDirectory)
 		err := os.MkdirAll(targetDirectory, os.ModePerm)
 		if err != nil {
 			return err
@@ -157,8 +172,15 @@ func copyFromFS(sourceFileSystem fs.FS, root string, targetDirectory string, all
 	}
 
 	rootWithTrailingSlash := fmt.Sprint(root, "/")
+	var directories []extractedDirectory //times are set once content is written
 
-	return fs.WalkDir(sourceFileSystem, root, func(path string, entry fs.DirEntry, err error) error {
+	err := fs.WalkDir(sourceFileSystem, root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		//Skip initial entry
 		if path == root {
 			return nil
@@ -170,7 +192,7 @@ func copyFromFS(sourceFileSystem fs.FS, root string, targetDirectory string, all
 		}
 
 		if !allowRegExp.MatchString(relativePathInArchive) {
-			log.Traceln(relativePathInArchive, "discarded because of regex", allowRegExp.String())
+			logger.Traceln(relativePathInArchive, "discarded because of regex", allowRegExp.String())
 			if entry.IsDir() {
 				return filepath.SkipDir
 			} else {
@@ -178,76 +200,267 @@ func copyFromFS(sourceFileSystem fs.FS, root string, targetDirectory string, all
 			}
 		}
 
+		//Zip slip
+		if !filepath.IsLocal(filepath.FromSlash(relativePathInArchive)) {
+			return errors.Join(errInvalidArchive, errors.New(fmt.Sprint("entry ", path, " would be extracted outside of ", targetDirectory)))
+		}
+		destination := filepath.Join(targetDirectory, filepath.FromSlash(relativePathInArchive))
+		//Symlinks extracted before must not lead outside either
+		if !insideFolder(targetDirectory, filepath.Dir(destination)) {
+			return errors.Join(errInvalidArchive, errors.New(fmt.Sprint("entry ", path, " would be extracted through a symlink outside of ", targetDirectory)))
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
 		// If the object is a directory, create it
 		if entry.IsDir() {
-			return os.MkdirAll(filepath.Join(targetDirectory, relativePathInArchive), os.ModePerm)
-		} else {
-			// Path of file directory
-			basePathInTarget := filepath.Join(targetDirectory, filepath.Dir(relativePathInArchive))
-
-			//Creates file directory
-			if !helper.FileOrDirExists(basePathInTarget) {
-				err = os.MkdirAll(basePathInTarget, os.ModePerm)
-				if err != nil {
-					return err
-				}
-			}
-
-			sourceReader, err := sourceFileSystem.Open(path)
-			if err != nil {
+			if err := os.MkdirAll(destination, os.ModePerm); err != nil {
 				return err
 			}
-			defer func(sourceReader fs.File) {
-				err := sourceReader.Close()
-				if err != nil {
-					log.Warnln("Cannot close", path, "from archive")
-				}
-			}(sourceReader)
+			directories = append(directories, extractedDirectory{destination, info})
+			return nil
+		} else if info.Mode()&fs.ModeSymlink != 0 {
+			return copySymlink(logger, sourceFileSystem, path, targetDirectory, destination)
+		} else if !info.Mode().IsRegular() {
+			logger.Debugln("Skipping special file", path)
+			return nil
+		} else {
+			return extractFile(ctx, logger, sourceFileSystem, path, destination, info)
+		}
 
-			// Create the file
-			targetCopy, err := os.Create(filepath.Join(targetDirectory, relativePathInArchive))
-			if err != nil {
-				return err
-			}
+	})
+	if err != nil {
+		return err
+	}
 
-			// Write the file
-			_, err = io.Copy(targetCopy, sourceReader)
-			if err != nil {
-				return err
-			}
-			return targetCopy.Close()
+	//Deepest first as setting a mode may prevent changes below
+	for index := len(directories) - 1; index >= 0; index-- {
+		applyModeAndTime(logger, directories[index].path, directories[index].info)
+	}
+	return nil
+}
+
+// extracting logs extraction start and shows a spinner until returned stop is called
+func extracting(logger *log.Logger) (stop func()) {
+	logger.Infoln("Extracting files from archive")
+	if helper.IsLive(logger) /*a spinner would mix with other apps output*/ {
+		s := spinner.New(spinner.CharSets[59], 300*time.Millisecond)
+		s.Prefix = "Please wait while extracting "
+		s.Start()
+		return s.Stop
+	}
+	return func() {}
+}
+
+type extractedDirectory struct {
+	path string
+	info fs.FileInfo
+}
+
+// extractFile copies a single file (its handles are closed before next entry)
+func extractFile(ctx context.Context, logger *log.Logger, sourceFileSystem fs.FS, name string, destination string, info fs.FileInfo) error {
+	sourceReader, err := sourceFileSystem.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func(sourceReader fs.File) {
+		err := sourceReader.Close()
+		if err != nil {
+			logger.Warnln("Cannot close", name, "from archive")
 		}
+	}(sourceReader)
 
-	})
+	return writeFile(ctx, logger, sourceReader, destination, info)
+}
+
+// writeFile writes content to destination with mode and time of info
+func writeFile(ctx context.Context, logger *log.Logger, content io.Reader, destination string, info fs.FileInfo) error {
+	//Creates file directory
+	if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+		return err
+	}
+
+	//Do not write through an existing symlink (see copySymlink)
+	if existing, err := os.Lstat(destination); err == nil && existing.Mode()&fs.ModeSymlink != 0 {
+		if err := os.Remove(destination); err != nil {
+			return err
+		}
+	}
+
+	// Create the file
+	targetCopy, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
 
+	// Write the file
+	if _, err = io.Copy(targetCopy, contextReader{ctx, content}); err != nil {
+		_ = targetCopy.Close()
+		return err
+	}
+	if err := targetCopy.Close(); err != nil {
+		return err
+	}
+
+	applyModeAndTime(logger, destination, info)
+	return nil
 }
 
-// Some archive contain a single folder at root, which then contains content...
-// We want to avoid unnecessary sub paths...
-func guessDeepestRootFolder(fsys fs.FS) (string, error) {
-	filesCount := 0
-	candidates := map[string]int{}
-	root := "."
-	err := fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
-		if path == root {
-			return nil
+// contextReader stops a (long) copy once ctx is canceled
+type contextReader struct {
+	ctx context.Context
+	io.Reader
+}
+
+func (reader contextReader) Read(p []byte) (int, error) {
+	if err := reader.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return reader.Reader.Read(p)
+}
+
+// applyModeAndTime keeps permissions (executable bit...) and modification time of an archive entry
+// On windows only read-only would be kept and would block upgrades, thus permissions are skipped
+func applyModeAndTime(logger *log.Logger, destination string, info fs.FileInfo) {
+	//Group/others write is dropped like umask would (archives made on windows say 0666)
+	if permissions := info.Mode().Perm() &^ 0022; permissions != 0 && runtime.GOOS != "windows" {
+		if info.IsDir() {
+			permissions |= 0700 //still writable by nomad (upgrades, restored files...)
+		}
+		if err := os.Chmod(destination, permissions); err != nil {
+			logger.Warnln("Cannot set mode of", destination, "|", err)
+		}
+	}
+	if modified := info.ModTime(); !modified.IsZero() {
+		if err := os.Chtimes(destination, modified, modified); err != nil {
+			logger.Warnln("Cannot set time of", destination, "|", err)
+		}
+	}
+}
+
+// copySymlink recreates a symlink of the archive (target kept as is, most often relative)
+// Links pointing outside targetDirectory are skipped
+// Zip and 7z archives store the target as content
+func copySymlink(logger *log.Logger, fsys fs.FS, name string, targetDirectory string, destination string) error {
+	target, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	return createSymlink(logger, name, string(target), targetDirectory, destination)
+}
+
+// createSymlink links destination to target unless it is absolute or resolves outside targetDirectory
+func createSymlink(logger *log.Logger, name string, target string, targetDirectory string, destination string) error {
+	if filepath.IsAbs(target) || strings.HasPrefix(target, "/") {
+		logger.Warnln("Skipping symlink", name, "with absolute target", target)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+		return err
+	}
+	if resolved, err := resolveLinkTarget(filepath.Dir(destination), target); err != nil || !insideFolder(targetDirectory, resolved) {
+		logger.Warnln("Skipping symlink", name, "pointing outside of app folder", target)
+		return nil
+	}
+	if _, err := os.Lstat(destination); err == nil {
+		if err := os.Remove(destination); err != nil {
+			return err
 		}
+	}
+	logger.Traceln("Linking", destination, "->", target)
+	if err := os.Symlink(filepath.FromSlash(target), destination); err != nil {
+		//Symlinks may need admin rights (windows)
+		logger.Warnln("Cannot create symlink", destination, "->", target, "|", err)
+	}
+	return nil
+}
 
-		if !d.IsDir() {
-			paths := strings.Builder{}
-			split := strings.Split(path, "/")
-			directoryParts := split[:len(split)-1 /*discard file*/]
-			for _, dir := range directoryParts { /*zip spec asks for slash for path sep...*/
-				paths.WriteString(fmt.Sprint(dir, "/"))
-				candidates[paths.String()]++
+// resolveLinkTarget follows target from directory like the system would (symlinks already extracted are followed)
+// A ".." after a missing component is refused as its meaning would depend on entries extracted later
+func resolveLinkTarget(directory string, target string) (string, error) {
+	current, err := filepath.EvalSymlinks(directory)
+	if err != nil {
+		return "", err
+	}
+	for _, part := range strings.Split(filepath.ToSlash(target), "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if _, err := os.Lstat(current); err != nil {
+				return "", err
+			}
+			current = filepath.Dir(current)
+		default:
+			current = filepath.Join(current, part)
+			if info, err := os.Lstat(current); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+				if current, err = filepath.EvalSymlinks(current); err != nil {
+					return "", err
+				}
 			}
-			filesCount++
 		}
+	}
+	return current, nil
+}
+
+// insideFolder tells if path really is in folder (symlinks followed, path may not exist yet)
+func insideFolder(folder string, path string) bool {
+	realFolder, err := filepath.EvalSymlinks(folder)
+	if err != nil {
+		return false
+	}
+	missing := ""
+	for {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			relative, err := filepath.Rel(realFolder, filepath.Join(real, missing))
+			return err == nil && (relative == "." || filepath.IsLocal(relative))
+		} else if _, lstatErr := os.Lstat(path); lstatErr == nil /*dangling link*/ || !errors.Is(err, fs.ErrNotExist) {
+			return false
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		missing = filepath.Join(filepath.Base(path), missing)
+		path = parent
+	}
+}
 
+// Some archive contain a single folder at root, which then contains content...
+// We want to avoid unnecessary sub paths...
+func guessDeepestRootFolder(fsys fs.FS) (string, error) {
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != "." && !d.IsDir() {
+			files = append(files, path)
+		}
 		return nil
 	})
 	if err != nil {
-		return root, err
+		return ".", err
+	}
+	return deepestRootFolder(files), nil
+}
+
+// deepestRootFolder returns the deepest folder containing all files (slash paths)
+func deepestRootFolder(files []string) string {
+	filesCount := len(files)
+	candidates := map[string]int{}
+	root := "."
+	for _, path := range files {
+		paths := strings.Builder{}
+		split := strings.Split(path, "/")
+		directoryParts := split[:len(split)-1 /*discard file*/]
+		for _, dir := range directoryParts { /*zip spec asks for slash for path sep...*/
+			paths.WriteString(fmt.Sprint(dir, "/"))
+			candidates[paths.String()]++
+		}
 	}
 	var winners []string //to handle multiple subdirectories...
 	for candidate, viewCount := range candidates {
@@ -266,5 +479,5 @@ func guessDeepestRootFolder(fsys fs.FS) (string, error) {
 		}
 	}
 
-	return champion, nil
+	return champion
 }
@@ -1,10 +1,22 @@
 package installer
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/gologme/log"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 const sub1 = "sub1"
@@ -55,8 +67,8 @@ func Test_copy(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			allRe, _ := regexp.Compile("(.*)")
-			if err := copyFromFS(tt.args.sourceFileSystem, tt.args.root, tt.args.targetDirectory, allRe); (err != nil) != tt.wantErr {
-				t.Errorf("copyFromFS() error = %v, wantErr %v", err, tt.wantErr)
+			if err := copyFromFS(context.Background(), log.Default(), tt.args.sourceFileSystem, tt.args.root, tt.args.targetDirectory, allRe); (err != nil) != tt.wantErr {
+				t.Errorf("copyFromFS(context.Background(), log.Default(), ) error = %v, wantErr %v", err, tt.wantErr)
 			}
 			err := os.RemoveAll(target)
 			if err != nil {
@@ -65,3 +77,188 @@ func Test_copy(t *testing.T) {
 		})
 	}
 }
+
+func Test_extract7zArchive(t *testing.T) {
+	content, err := os.ReadFile("../../../test/data/simple.7z")
+	assert.NoError(t, err)
+	directory := t.TempDir()
+
+	//Simulated sfx (stub before 7z payload)
+	sfx := filepath.Join(directory, "app.7sfx")
+	assert.NoError(t, os.WriteFile(sfx, append(bytes.Repeat([]byte("MZ stub"), 1000), content...), os.ModePerm))
+	target := filepath.Join(directory, "sfx")
+	definition := data.AppDefinition{DownloadUrl: "https://example.org/app.7z.exe", DownloadExtension: ".7sfx", ExtractRegExList: []string{"^bar$"}}
+	_, _ = definition.IsValid()
+	assert.NoError(t, extractArchive(context.Background(), log.Default(), sfx, definition, target))
+	assert.True(t, fileExists(filepath.Join(target, "bar")))
+	assert.False(t, fileExists(filepath.Join(target, "foo"))) //filtered
+
+	//Truncated download
+	broken := filepath.Join(directory, "broken.7z")
+	assert.NoError(t, os.WriteFile(broken, content[:len(content)/2], os.ModePerm))
+	definition = data.AppDefinition{DownloadUrl: "https://example.org/app.7z"}
+	definition.ComputeDownloadExtension()
+	_, _ = definition.IsValid()
+	assert.True(t, errors.Is(extractArchive(context.Background(), log.Default(), broken, definition, filepath.Join(directory, "broken")), errInvalidArchive))
+}
+
+func Test_extractZipArchive(t *testing.T) {
+	directory := t.TempDir()
+	archive := filepath.Join(directory, "app.zip")
+	modified := time.Date(2020, 2, 2, 10, 0, 0, 0, time.UTC)
+	content := bytes.Buffer{}
+	writer := zip.NewWriter(&content)
+	for _, entry := range []struct {
+		name string
+		mode fs.FileMode
+		body string
+	}{
+		{"app/bin/app", 0755, "#!/bin"},
+		{"app/../../evil.txt", 0644, "evil"}, //zip slip
+		{"app/link", fs.ModeSymlink | 0777, "bin/app"},
+		{"app/escaping", fs.ModeSymlink | 0777, "../../../etc/passwd"},
+	} {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: modified}
+		header.SetMode(entry.mode)
+		file, err := writer.CreateHeader(header)
+		assert.NoError(t, err)
+		_, err = file.Write([]byte(entry.body))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, os.WriteFile(archive, content.Bytes(), os.ModePerm))
+
+	target := filepath.Join(directory, "apps", "app-1.0")
+	definition := data.AppDefinition{DownloadUrl: "https://example.org/app.zip"}
+	definition.ComputeDownloadExtension()
+	_, _ = definition.IsValid()
+	assert.NoError(t, extractArchive(context.Background(), log.Default(), archive, definition, target))
+
+	//Zip slip entry stays in target (thus no root folder to remove)
+	assert.False(t, fileExists(filepath.Join(directory, "evil.txt")))
+	assert.False(t, fileExists(filepath.Join(directory, "apps", "evil.txt")))
+	assert.True(t, fileExists(filepath.Join(target, "evil.txt")))
+	target = filepath.Join(target, "app")
+	_, err := os.Lstat(filepath.Join(target, "escaping"))
+	assert.True(t, os.IsNotExist(err))
+
+	info, err := os.Stat(filepath.Join(target, "bin", "app"))
+	assert.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(modified))
+	if runtime.GOOS != "windows" {
+		assert.Eq(t, os.FileMode(0755), info.Mode().Perm())
+		linkTarget, err := os.Readlink(filepath.Join(target, "link"))
+		assert.NoError(t, err)
+		assert.Eq(t, "bin/app", linkTarget)
+	}
+}
+
+func Test_extractZipArchiveChainedSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need admin rights")
+	}
+	tests := []struct {
+		name    string
+		entries [][2]string //name, link target (empty for a file)
+	}{
+		{"link through a link", [][2]string{{"x/a/up", ".."}, {"x/l", "a/up/.."}, {"x/file", ""}}},
+		{"link through a later link", [][2]string{{"x/0", "a/up/.."}, {"x/a/up", ".."}, {"x/file", ""}}}, //walked in lexical order
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := t.TempDir()
+			archive := filepath.Join(directory, "app.zip")
+			content := bytes.Buffer{}
+			writer := zip.NewWriter(&content)
+			for _, entry := range tt.entries {
+				header := &zip.FileHeader{Name: entry[0], Method: zip.Deflate}
+				if entry[1] != "" {
+					header.SetMode(fs.ModeSymlink | 0777)
+				}
+				file, err := writer.CreateHeader(header)
+				assert.NoError(t, err)
+				_, err = file.Write([]byte(entry[1]))
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, writer.Close())
+			assert.NoError(t, os.WriteFile(archive, content.Bytes(), os.ModePerm))
+
+			target := filepath.Join(directory, "apps", "app-1.0")
+			definition := data.AppDefinition{DownloadUrl: "https://example.org/app.zip"}
+			definition.ComputeDownloadExtension()
+			_, _ = definition.IsValid()
+			assert.NoError(t, extractArchive(context.Background(), log.Default(), archive, definition, target))
+
+			//No link leads out of the version folder
+			realTarget, _ := filepath.EvalSymlinks(target)
+			assert.NoError(t, filepath.WalkDir(target, func(path string, entry fs.DirEntry, err error) error {
+				if err == nil && entry.Type()&fs.ModeSymlink != 0 {
+					resolved, err := filepath.EvalSymlinks(path)
+					assert.NoError(t, err)
+					relative, _ := filepath.Rel(realTarget, resolved)
+					assert.True(t, relative == "." || filepath.IsLocal(relative), path, "->", resolved)
+				}
+				return err
+			}))
+		})
+	}
+}
+
+func Test_extractZipArchiveThroughEscapingSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need admin rights")
+	}
+	directory := t.TempDir()
+	target := filepath.Join(directory, "apps", "app-1.0")
+	assert.NoError(t, os.MkdirAll(target, os.ModePerm))
+	assert.NoError(t, os.Symlink("..", filepath.Join(target, "out"))) //as if left by a previous entry
+
+	err := copyFromFS(context.Background(), log.Default(), fstest.MapFS{"out/evil.txt": {Data: []byte("evil")}}, ".", target, regexp.MustCompile(".*"))
+	assert.True(t, errors.Is(err, errInvalidArchive))
+	assert.False(t, fileExists(filepath.Join(directory, "apps", "evil.txt")))
+}
+
+func Test_extractTarRejectsEscapingPath(t *testing.T) {
+	content := bytes.Buffer{}
+	writer := tar.NewWriter(&content)
+	assert.NoError(t, writer.WriteHeader(&tar.Header{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0644}))
+	assert.NoError(t, writer.Close())
+	archive := filepath.Join(t.TempDir(), "evil.tar")
+	assert.NoError(t, os.WriteFile(archive, content.Bytes(), os.ModePerm))
+
+	target := filepath.Join(t.TempDir(), "app")
+	err := extractTar(context.Background(), log.Default(), archive, "", target, regexp.MustCompile(".*"))
+	assert.True(t, errors.Is(err, errInvalidArchive))
+	assert.ErrSubMsg(t, err, "invalid path in archive")
+	assert.False(t, fileExists(target+".tar"))
+}
+
+// escapingFS lists a ".." entry like a malicious archive reader could
+type escapingFS struct {
+	fstest.MapFS
+}
+
+func (fsys escapingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fsys.MapFS.ReadDir(name)
+	if name == "." {
+		info, _ := fsys.MapFS.Stat("evil")
+		entries = append(entries, fs.FileInfoToDirEntry(renamedInfo{info, ".."}))
+	}
+	return entries, err
+}
+
+type renamedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (info renamedInfo) Name() string {
+	return info.name
+}
+
+func Test_copyFromFSRejectsEscapingPath(t *testing.T) {
+	fsys := escapingFS{fstest.MapFS{"evil": {Data: []byte("evil")}}}
+	allRe, _ := regexp.Compile("(.*)")
+	err := copyFromFS(context.Background(), log.Default(), fsys, ".", t.TempDir(), allRe)
+	assert.True(t, errors.Is(err, errInvalidArchive))
+}
@@ -0,0 +1,181 @@
+package installer
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"hash"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+var hashers = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// Github locations of releases (replaced by a local server in tests)
+var (
+	githubURL    = data.GITHUB_BASE_URL
+	githubApiURL = data.GITHUB_API_URL
+)
+
+// archiveChecksum returns the checksum of definition (placeholders filled) or the one published in github release (if any)
+func archiveChecksum(ctx context.Context, logger *log.Logger, definition data.AppDefinition, targetVersion *version.Version, downloadURL string) (string, error) {
+	if definition.Checksum != "" {
+		return fill(logger, definition.Checksum, renderValues(definition, targetVersion, "")), nil
+	}
+	return discoverChecksum(ctx, logger, downloadURL, definition.SslIgnoreBadCert)
+}
+
+// discoverChecksum looks for the hash of a github release asset in checksum files published with it
+// Returns empty string if not a github release or if no checksum is published, an error if release cannot be checked
+func discoverChecksum(ctx context.Context, logger *log.Logger, downloadURL string, ignoreBadCert bool) (string, error) {
+	owner, repo, tag, asset, found := data.GithubReleaseAsset(downloadURL)
+	if !found {
+		return "", nil
+	}
+
+	assets, err := helper.GetGithubReleaseAssets(ctx, data.GithubReleaseRequest(githubApiURL, owner, repo, tag), configuration.Settings.GithubApiKey)
+	if err != nil {
+		return "", fmt.Errorf("cannot list release %s assets | %w", tag, err)
+	}
+
+	for _, candidate := range checksumAssetNames(asset, repo, tag) {
+		for _, name := range assets {
+			if !strings.EqualFold(name, candidate) {
+				continue
+			}
+			checksumURL := fmt.Sprint(githubURL, owner, "/", repo, "/releases/download/", tag, "/", name)
+			content, err := helper.DownloadText(ctx, checksumURL, ignoreBadCert)
+			if err != nil {
+				return "", fmt.Errorf("cannot get checksum file %s | %w", checksumURL, err)
+			}
+			if sum, err := findChecksum(content, asset); err == nil {
+				logger.Infoln("Using checksum published in release", tag, "(", name, ")")
+				return sum, nil
+			}
+		}
+	}
+	logger.Debugln("No checksum published for", asset, "in release", tag)
+	return "", nil
+}
+
+// checksumAssetNames lists usual checksum files names (by preference)
+func checksumAssetNames(asset string, repo string, tag string) []string {
+	releaseVersion := strings.TrimPrefix(tag, "v")
+	return []string{
+		asset + ".sha256",
+		asset + ".sha256sum",
+		asset + ".sha512",
+		asset + ".sha512sum",
+		"SHA256SUMS",
+		"SHA256SUMS.txt",
+		"sha256sum.txt",
+		"SHA512SUMS",
+		"SHA512SUMS.txt",
+		"checksums.txt",
+		fmt.Sprint(repo, "_", releaseVersion, "_checksums.txt"), //goreleaser
+		fmt.Sprint(repo, "-", releaseVersion, "-checksums.txt"),
+	}
+}
+
+// verifyChecksum checks archive content against checksum (see AppDefinition.Checksum)
+// A mismatch is reported with errChecksumMismatch, other errors are resolution issues (bad format, network...)
+func verifyChecksum(ctx context.Context, logger *log.Logger, archivePath string, checksum string, downloadURL string, ignoreBadCert bool) error {
+	algorithm, expected, err := resolveChecksum(ctx, logger, checksum, downloadURL, ignoreBadCert)
+	if err != nil {
+		return err
+	}
+
+	actual, err := helper.FileHash(archivePath, hashers[algorithm]())
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w, expected %s %s got %s", errChecksumMismatch, algorithm, expected, actual)
+	}
+	logger.Debugln("Archive", algorithm, "checksum verified", actual)
+	return nil
+}
+
+// resolveChecksum returns algorithm and hex hash from a checksum definition
+// Algorithm is guessed from hash length if not given as prefix (sha256:...)
+func resolveChecksum(ctx context.Context, logger *log.Logger, checksum string, downloadURL string, ignoreBadCert bool) (algorithm string, expected string, err error) {
+	expected = strings.TrimSpace(checksum)
+	if prefix, value, found := strings.Cut(expected, ":"); found {
+		if _, known := hashers[strings.ToLower(prefix)]; known {
+			algorithm, expected = strings.ToLower(prefix), value
+		}
+	}
+
+	//Checksum file
+	if strings.HasPrefix(expected, "http") {
+		logger.Debugln("Getting checksum from", expected)
+		content, err := helper.DownloadText(ctx, expected, ignoreBadCert)
+		if err != nil {
+			return "", "", fmt.Errorf("cannot get checksum file %s | %w", expected, err)
+		}
+		if expected, err = findChecksum(content, downloadFileName(downloadURL)); err != nil {
+			return "", "", err
+		}
+	}
+
+	if algorithm == "" {
+		switch len(expected) {
+		case sha256.Size * 2:
+			algorithm = "sha256"
+		case sha512.Size * 2:
+			algorithm = "sha512"
+		default:
+			return "", "", errors.New(fmt.Sprint("cannot guess checksum algorithm of ", expected, " (use sha256: or sha512: prefix)"))
+		}
+	}
+	if _, err := hex.DecodeString(expected); err != nil {
+		return "", "", errors.New(fmt.Sprint("bad checksum ", expected, " (hexadecimal expected)"))
+	}
+	return
+}
+
+// findChecksum extracts the hash of fileName from a checksum file content
+// Supported formats: single hash, "hash  file" (sha256sum) and "SHA256 (file) = hash" (BSD)
+func findChecksum(content string, fileName string) (string, error) {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 1 && len(lines) == 1:
+			return fields[0], nil
+		case len(fields) == 4 && fields[1] == fmt.Sprint("(", fileName, ")") && fields[2] == "=":
+			return fields[3], nil
+		case len(fields) >= 2 && path.Base(strings.TrimPrefix(fields[len(fields)-1], "*")) == fileName:
+			return fields[0], nil
+		}
+	}
+	return "", errors.New(fmt.Sprint("no checksum found for ", fileName))
+}
+
+// downloadFileName returns the file name part of a download URL (without query)
+func downloadFileName(downloadURL string) string {
+	if parsed, err := url.Parse(downloadURL); err == nil {
+		return path.Base(parsed.Path)
+	}
+	return path.Base(downloadURL)
+}
@@ -0,0 +1,160 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const abcSha256 = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+const abcSha512 = "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"
+
+func Test_findChecksum(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{"single hash", abcSha256 + "\n", abcSha256, false},
+		{"sha256sum", "0000  other.zip\n" + abcSha256 + "  app-1.0.zip\n", abcSha256, false},
+		{"binary mode", abcSha256 + " *app-1.0.zip", abcSha256, false},
+		{"with dir", abcSha256 + "  dist/app-1.0.zip", abcSha256, false},
+		{"bsd", "SHA256 (app-1.0.zip) = " + abcSha256, abcSha256, false},
+		{"not found", "0000  other.zip\n1111  another.zip", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findChecksum(tt.content, "app-1.0.zip")
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_resolveChecksum(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, abcSha512, " app-1.0.zip")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		checksum      string
+		wantAlgorithm string
+		want          string
+		wantErr       bool
+	}{
+		{"guess sha256", abcSha256, "sha256", abcSha256, false},
+		{"guess sha512", abcSha512, "sha512", abcSha512, false},
+		{"prefix", "sha256:" + abcSha256, "sha256", abcSha256, false},
+		{"url", server.URL + "/SHA512SUMS", "sha512", abcSha512, false},
+		{"unknown length", "abcd", "", "", true},
+		{"not hex", "sha256:xyz", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			algorithm, got, err := resolveChecksum(context.Background(), log.Default(), tt.checksum, "https://example.org/download/app-1.0.zip?raw=1", false)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.wantAlgorithm, algorithm)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_downloadArchiveVerifiesReusedArchive(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "app-1.0.zip")
+	assert.NoError(t, os.WriteFile(archive, []byte("abc"), os.ModePerm))
+
+	downloaded, err := downloadArchive(context.Background(), log.Default(), "https://example.org/app-1.0.zip", true, archive, abcSha256, false)
+	assert.NoError(t, err)
+	assert.Eq(t, int64(0), downloaded)
+	assert.True(t, errors.Is(verifyChecksum(context.Background(), log.Default(), archive, "sha512:"+abcSha256+abcSha256, "", false), errChecksumMismatch))
+
+	_, err = downloadArchive(context.Background(), log.Default(), "https://example.org/app-1.0.zip", true, archive, "sha256:"+abcSha512[:64], false)
+	assert.ErrSubMsg(t, err, "checksum mismatch")
+	assert.False(t, fileExists(archive))
+	matches, _ := filepath.Glob(archive + "-*.bad")
+	assert.Len(t, matches, 1)
+}
+
+func Test_checksumAssetNames(t *testing.T) {
+	names := checksumAssetNames("app-1.0.zip", "app", "v1.0")
+	assert.Eq(t, "app-1.0.zip.sha256", names[0])
+	assert.Contains(t, names, "SHA256SUMS")
+	assert.Contains(t, names, "checksums.txt")
+	assert.Contains(t, names, "app_1.0_checksums.txt")
+	assert.Contains(t, names, "app-1.0-checksums.txt")
+}
+
+func Test_discoverChecksum(t *testing.T) {
+	//Release assets and files by release tag
+	releases := map[string]map[string]string{
+		"v1": {"app-1.0.zip": "", "app-1.0.zip.sha256": abcSha256 + "\n"},
+		"v2": {"app-1.0.zip": "", "SHA256SUMS": "0000  other.zip\n" + abcSha512 + "  app-1.0.zip\n"},
+		"v3": {"app-1.0.zip": "", "checksums.txt": "SHA256 (app-1.0.zip) = " + abcSha256},
+		"v4": {"app-1.0.zip": "", "notes.txt": "nothing"},
+		"v5": {"app-1.0.zip": "", "checksums.txt": "0000  other.zip"},
+		"v6": {"app-1.0.zip": "", "SHA256SUMS": ""}, //file download fails
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.URL.Path, "/") // /repos/owner/app/releases/tags/<tag> or /owner/app/releases/download/<tag>/<name>
+		switch {
+		case len(parts) == 7 && parts[1] == "repos" && parts[5] == "tags":
+			if parts[6] == "v0" {
+				http.Error(w, `{"message":"API rate limit exceeded"}`, http.StatusForbidden)
+				return
+			}
+			var assets []string
+			for asset := range releases[parts[6]] {
+				assets = append(assets, fmt.Sprintf(`{"name":%q}`, asset))
+			}
+			_, _ = fmt.Fprint(w, `{"assets":[`, strings.Join(assets, ","), `]}`)
+		case len(parts) == 7 && parts[4] == "download" && releases[parts[5]][parts[6]] != "":
+			_, _ = fmt.Fprint(w, releases[parts[5]][parts[6]])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	formerURL, formerApiURL := githubURL, githubApiURL
+	githubURL, githubApiURL = server.URL+"/", server.URL+"/"
+	defer func() { githubURL, githubApiURL = formerURL, formerApiURL }()
+
+	tests := []struct {
+		name    string
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{"asset.sha256", "v1", abcSha256, false},
+		{"SHA256SUMS with many entries", "v2", abcSha512, false},
+		{"checksums.txt", "v3", abcSha256, false},
+		{"no checksum asset", "v4", "", false},
+		{"asset not in sums", "v5", "", false},
+		{"sums not downloadable", "v6", "", true},
+		{"api error", "v0", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := discoverChecksum(context.Background(), log.Default(), data.GITHUB_BASE_URL+"owner/app/releases/download/"+tt.tag+"/app-1.0.zip", false)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	got, err := discoverChecksum(context.Background(), log.Default(), "https://example.org/app-1.0.zip", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", got)
+}
@@ -0,0 +1,223 @@
+package installer
+
+import (
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	SEVERITY_INFO = Severity(iota)
+	SEVERITY_WARNING
+	SEVERITY_ERROR
+)
+
+type Severity int
+
+func (severity Severity) String() string {
+	switch severity {
+	case SEVERITY_INFO:
+		return "info"
+	case SEVERITY_WARNING:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// Problem found by Diagnose, some can be repaired with Fix
+type Problem struct {
+	Severity Severity
+	Path     string
+	Message  string
+	Fixed    bool
+	fix      func() error
+}
+
+func (problem *Problem) Fixable() bool {
+	return problem.fix != nil
+}
+
+// Fix applies the (safe) repair of the problem if any
+func (problem *Problem) Fix() error {
+	if problem.fix == nil || problem.Fixed {
+		return nil
+	}
+	if err := problem.fix(); err != nil {
+		return err
+	}
+	problem.Fixed = true
+	return nil
+}
+
+func removeFix(path string) func() error {
+	return func() error {
+		return os.Remove(path)
+	}
+}
+
+// Diagnose scans apps, shortcuts and archives directories for inconsistencies
+func Diagnose(archivesSubDir string) (problems []*Problem) {
+	installedApps := state.ScanCurrentApps(configuration.AppPath)
+
+	problems = append(problems, diagnoseApps(configuration.AppPath, archivesSubDir)...)
+	problems = append(problems, diagnoseShortcuts(configuration.DefaultShortcutsDir, installedApps)...)
+	problems = append(problems, diagnoseArchives(filepath.Join(configuration.AppPath, archivesSubDir))...)
+	problems = append(problems, diagnoseShortcutGenerators(".")...)
+
+	return
+}
+
+func diagnoseApps(appPath string, archivesSubDir string) (problems []*Problem) {
+	if !helper.FileOrDirExists(appPath) {
+		return
+	}
+	entries, err := os.ReadDir(appPath)
+	if err != nil {
+		return []*Problem{{Severity: SEVERITY_ERROR, Path: appPath, Message: fmt.Sprint("cannot read apps directory | ", err)}}
+	}
+
+	database, err := state.LoadDatabase(appPath)
+	if err != nil {
+		problems = append(problems, &Problem{Severity: SEVERITY_WARNING, Path: filepath.Join(appPath, configuration.StateFileName),
+			Message: fmt.Sprint("cannot read install state (apps identified from folder names) | ", err)})
+	}
+
+	symlinks := map[string]string{}
+	for app, definition := range configuration.Settings.AppDefinitions {
+		symlinks[definition.Symlink] = app
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(appPath, entry.Name())
+		if strings.HasPrefix(entry.Name(), ".") || entry.Name() == archivesSubDir || entry.Name() == configuration.DefaultBackupsDir {
+			continue
+		}
+
+		if helper.IsSymlink(entryPath) {
+			if _, err := os.Stat(entryPath); err != nil {
+				problems = append(problems, &Problem{Severity: SEVERITY_ERROR, Path: entryPath,
+					Message: fmt.Sprint("symlink points to missing target ", helper.GetSymlinkTarget(entryPath)),
+					fix:     removeFix(entryPath)})
+			} else if _, known := symlinks[entry.Name()]; !known {
+				problems = append(problems, &Problem{Severity: SEVERITY_INFO, Path: entryPath, Message: "symlink not matching any app definition"})
+			}
+			continue
+		}
+
+		if !entry.IsDir() {
+			problems = append(problems, &Problem{Severity: SEVERITY_INFO, Path: entryPath, Message: "unexpected file"})
+			continue
+		}
+
+		if database.IsDataFolder(entry.Name()) {
+			continue
+		}
+
+		app, versionString, found := database.Identify(entry.Name())
+		if !found {
+			problems = append(problems, &Problem{Severity: SEVERITY_INFO, Path: entryPath, Message: "folder not following app-version naming"})
+		} else if _, err := version.FromString(versionString); err != nil {
+			problems = append(problems, &Problem{Severity: SEVERITY_WARNING, Path: entryPath, Message: fmt.Sprint("cannot parse version ", versionString)})
+		} else if _, known := configuration.Settings.AppDefinitions[app]; !known {
+			problems = append(problems, &Problem{Severity: SEVERITY_WARNING, Path: entryPath, Message: fmt.Sprint("unknown app ", app, " (no definition)")})
+		}
+	}
+	return
+}
+
+func diagnoseShortcuts(shortcutsDir string, installedApps state.AppStates) (problems []*Problem) {
+	if !helper.FileOrDirExists(shortcutsDir) {
+		return
+	}
+	entries, err := os.ReadDir(shortcutsDir)
+	if err != nil {
+		return []*Problem{{Severity: SEVERITY_ERROR, Path: shortcutsDir, Message: fmt.Sprint("cannot read shortcuts directory | ", err)}}
+	}
+
+	//Expected shortcuts of installed apps
+	expectedTargets := map[string]string{}
+	for _, appState := range installedApps {
+		if appState.Definition.Shortcut != "" && appState.CurrentVersion != nil {
+			shortcut := fill(appState.Logger(), appState.Definition.Shortcut, renderValues(*appState.Definition, appState.CurrentVersion, appState.CurrentVersionFolder))
+			shortcutFile := filepath.Base(shortcutPath(filepath.Base(shortcut), shortcutsDir))
+			expectedTargets[shortcutFile] = filepath.Join(configuration.AppPath, appState.Definition.Symlink, shortcut)
+		}
+	}
+
+	//Names of shortcuts nomad creates, others belong to the user (or other tools) and are left alone
+	generated := map[string]bool{}
+	for shortcutFile := range expectedTargets {
+		generated[shortcutFile] = true
+	}
+	for _, definition := range configuration.Settings.AppDefinitions {
+		if definitionVersion, err := version.FromString(definition.Version); definition.Shortcut != "" && err == nil {
+			shortcut := fill(log.Default(), definition.Shortcut, renderValues(*definition, definitionVersion, ""))
+			generated[filepath.Base(shortcutPath(filepath.Base(shortcut), shortcutsDir))] = true
+		}
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(shortcutsDir, entry.Name())
+		if !generated[entry.Name()] {
+			continue
+		}
+		var target string
+		if helper.IsSymlink(entryPath) {
+			target = helper.GetSymlinkTarget(entryPath)
+		} else if expected, found := expectedTargets[entry.Name()]; found {
+			target = expected
+		} else {
+			problems = append(problems, &Problem{Severity: SEVERITY_WARNING, Path: entryPath, Message: "shortcut of an app not installed", fix: removeFix(entryPath)})
+			continue
+		}
+
+		if !helper.FileOrDirExists(target) {
+			problems = append(problems, &Problem{Severity: SEVERITY_WARNING, Path: entryPath, Message: fmt.Sprint("shortcut points to missing target ", target), fix: removeFix(entryPath)})
+		}
+	}
+	return
+}
+
+func diagnoseArchives(archivesDir string) (problems []*Problem) {
+	if !helper.FileOrDirExists(archivesDir) {
+		return
+	}
+	entries, err := os.ReadDir(archivesDir)
+	if err != nil {
+		return []*Problem{{Severity: SEVERITY_ERROR, Path: archivesDir, Message: fmt.Sprint("cannot read archives directory | ", err)}}
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(archivesDir, entry.Name())
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".bad") {
+			problems = append(problems, &Problem{Severity: SEVERITY_INFO, Path: entryPath, Message: "bad archive (use prune to remove it)"})
+		} else if info, err := entry.Info(); err == nil && info.Size() == 0 {
+			problems = append(problems, &Problem{Severity: SEVERITY_WARNING, Path: entryPath, Message: "empty archive", fix: removeFix(entryPath)})
+		}
+	}
+	return
+}
+
+// diagnoseShortcutGenerators looks for vbs scripts left by failed createShortcut runs
+func diagnoseShortcutGenerators(directory string) (problems []*Problem) {
+	matches, err := filepath.Glob(filepath.Join(directory, "lnkTo*.vbs"))
+	if err != nil {
+		log.Debugln("Cannot search shortcut generators |", err)
+		return
+	}
+	for _, match := range matches {
+		problems = append(problems, &Problem{Severity: SEVERITY_WARNING, Path: match, Message: "leftover shortcut generator", fix: removeFix(match)})
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package installer
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_diagnoseArchivesAndFix(t *testing.T) {
+	archivesDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(archivesDir, "empty-1.0.zip"), []byte{}, os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(archivesDir, "ok-1.0.zip"), []byte("zip"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(archivesDir, "broken-1.0.zip-2024-01-01X10_00_00.bad"), []byte("zip"), os.ModePerm))
+
+	problems := diagnoseArchives(archivesDir)
+
+	assert.Len(t, problems, 2)
+	for _, problem := range problems {
+		if problem.Severity == SEVERITY_WARNING {
+			assert.True(t, problem.Fixable())
+			assert.NoError(t, problem.Fix())
+			assert.True(t, problem.Fixed)
+			assert.False(t, fileExists(problem.Path))
+		} else {
+			assert.False(t, problem.Fixable())
+		}
+	}
+}
+
+func Test_diagnoseShortcutGenerators(t *testing.T) {
+	directory := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(directory, "lnkTocode.exe.vbs"), []byte{}, os.ModePerm))
+
+	problems := diagnoseShortcutGenerators(directory)
+
+	assert.Len(t, problems, 1)
+	assert.True(t, problems[0].Fixable())
+}
+
+func Test_diagnoseShortcutsKeepsUserShortcuts(t *testing.T) {
+	definitions := configuration.Settings.AppDefinitions
+	configuration.Settings.AppDefinitions = map[string]*data.AppDefinition{"app": {ApplicationName: "app", Symlink: "app", Version: "1.0", Shortcut: "bin/app.exe"}}
+	defer func() { configuration.Settings.AppDefinitions = definitions }()
+
+	shortcutsDir := t.TempDir()
+	generated := shortcutPath("app.exe", shortcutsDir)
+	assert.NoError(t, os.WriteFile(generated, []byte{}, os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(shortcutsDir, "user-made.lnk"), []byte{}, os.ModePerm))
+
+	problems := diagnoseShortcuts(shortcutsDir, state.NewAppStates())
+
+	//Only the shortcut nomad created for an app not installed anymore
+	assert.Len(t, problems, 1)
+	assert.Eq(t, generated, problems[0].Path)
+	assert.True(t, problems[0].Fixable())
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
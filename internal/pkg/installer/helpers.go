@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
 
 	"os"
 	"os/exec"
@@ -17,8 +18,16 @@ func isWindowsPlatform() bool {
 	return strings.Contains(runtime.GOOS, "windows")
 }
 
+// shortcutPath returns the file generated by createShortcut for the given link name
+func shortcutPath(linkName string, destination string) string {
+	if isWindowsPlatform() {
+		return filepath.Join(destination, fmt.Sprint(linkName, ".lnk"))
+	}
+	return path.Join(destination, linkName)
+}
+
 // https://stackoverflow.com/questions/32438204/create-a-windows-shortcut-lnk-in-go
-func createShortcut(linkName string, target string, arguments string, workingDirectory string, description string, destination string, icon string) {
+func createShortcut(logger *log.Logger, linkName string, target string, arguments string, workingDirectory string, description string, destination string, icon string) {
 
 	if isWindowsPlatform() {
 		var scriptTxt bytes.Buffer
@@ -61,26 +70,34 @@ func createShortcut(linkName string, target string, arguments string, workingDir
 		filename := fmt.Sprintf("lnkTo%s.vbs", linkName)
 		err := os.WriteFile(filename, scriptTxt.Bytes(), 0777)
 		if err != nil {
-			log.Errorln(err)
+			logger.Errorln(err)
 			return
 		}
 		cmd := exec.Command("wscript", filename)
 		err = cmd.Run()
 		if err != nil {
-			log.Errorln("Wscript error, see generator content in", filename, err)
+			logger.Errorln("Wscript error, see generator content in", filename, err)
 		} else {
-			log.Debugln("Shortcut ", linkName, "generated/updated")
+			logger.Debugln("Shortcut ", linkName, "generated/updated")
 			err = os.Remove(filename)
 			if err != nil {
-				log.Errorln("Cannot delete temp vbs shortcut generator", err)
+				logger.Errorln("Cannot delete temp vbs shortcut generator", err)
 				return
 			}
 		}
 
 	} else {
-		err := os.Symlink(target, path.Join(destination, linkName))
+		link := path.Join(destination, linkName)
+		//Regenerate (target may have changed)
+		if helper.IsSymlink(link) {
+			if err := os.Remove(link); err != nil {
+				logger.Errorln("cannot remove old symlink", link, err)
+				return
+			}
+		}
+		err := os.Symlink(target, link)
 		if err != nil {
-			log.Errorln("cannot generate symlink to", target, err)
+			logger.Errorln("cannot generate symlink to", target, err)
 			return
 		}
 	}
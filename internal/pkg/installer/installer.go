@@ -3,13 +3,14 @@ package installer
 import (
 	"archive/zip"
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/briandowns/spinner"
 	"github.com/gologme/log"
 	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
 	"github.com/jonathanMelly/nomad/internal/pkg/data"
 	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/render"
 	"github.com/jonathanMelly/nomad/internal/pkg/state"
 	"github.com/jonathanMelly/nomad/pkg/bytesize"
 	junction "github.com/nyaosorg/go-windows-junction"
@@ -21,6 +22,7 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -34,41 +36,56 @@ const (
 
 	EXIT_INSTALL_UPDATE_ERROR = 53
 
+	EXIT_UNINSTALL_ERROR = 54
+
+	EXIT_VERSION_NOT_INSTALLED = 55
+
+	EXIT_PRUNE_ERROR = 56
+	EXIT_LOCK_ERROR  = 57
+
 	EXIT_SYMLINK_ERROR  = 58
 	EXIT_SHORTCUT_ERROR = 59
+
+	EXIT_RECOVER_ERROR = 60
+
+	EXIT_CANCELED = 61 //ctrl-c, SIGTERM
 )
 
+var promptMutex sync.Mutex
+
 // InstallOrUpdate will execute commands from an app-definitions file
-func InstallOrUpdate(appState state.AppState, forceExtract bool, skipDownload bool,
-	customAppLocationForShortcut string, archivesSubDir string, askForConfirmation bool, refresh bool) (error error, errorMessage string, exitCode int) {
+// Confirmation (if any) must be asked before (see BuildPlan)
+// appState.Downloaded is updated with downloaded archive size
+// If ctx is canceled before the new version is in place, everything done is undone
+func InstallOrUpdate(ctx context.Context, appState *state.AppState, forceExtract bool, skipDownload bool,
+	customAppLocationForShortcut string, archivesSubDir string, refresh bool) (error error, errorMessage string, exitCode int) {
 
 	//Aliases
 	definition := appState.Definition
 	targetVersion := appState.TargetVersion
 	appName := definition.ApplicationName
 
-	//Prepend app name to logs
-	log.SetPrefix(helper.BuildPrefix(appName))
+	//Logs prefixed with app name
+	logger := appState.Logger()
 
 	//Enforce validation
 	if valid, err := definition.IsValid(); !valid {
 		return err, "invalid definition", EXIT_INVALID_DEFINITION
 	}
 
-	//Show status
-	log.Infoln(appState.StatusMessage())
+	//Status already shown by plan
+	logger.Debugln(appState.StatusMessage())
 
 	if appState.Status != state.KEEP || refresh {
-		//User confirm
-		abort := !userWantsToContinue(askForConfirmation)
-		if abort {
-			return nil, "Action aborted by user", EXIT_ABORTED_BY_USER
+		//Self update needs the key embedded at build time, nothing is downloaded without it
+		if appName == "nomad" && configuration.NomadPublicKey == "" {
+			return errors.New("no trusted key embedded in this build"), "Cannot install/update nomad, please replace binary manually", EXIT_INSTALL_UPDATE_ERROR
 		}
 
 		//Create app path if needed
 		if !helper.FileOrDirExists(configuration.AppPath) {
-			log.Debugln("Creating", configuration.AppPath, "directory")
-			err := os.Mkdir(configuration.AppPath, os.ModePerm)
+			logger.Debugln("Creating", configuration.AppPath, "directory")
+			err := os.MkdirAll(configuration.AppPath, os.ModePerm) /*concurrent installs (-jobs)*/
 			if err != nil {
 				return err, fmt.Sprint("Cannot create ", configuration.AppPath), EXIT_OK
 			}
@@ -78,42 +95,123 @@ func InstallOrUpdate(appState state.AppState, forceExtract bool, skipDownload bo
 		var targetAppPath = path.Join(configuration.AppPath, appNameWithVersion)
 		var archivesDir = path.Join(configuration.AppPath, archivesSubDir)
 
+		//Install state (previous record kept if folder is not extracted again)
+		database, err := state.LoadDatabase(configuration.AppPath)
+		if err != nil {
+			logger.Warnln("Cannot read install state, it will be rewritten |", err)
+		}
+		record, _ := database.Record(appNameWithVersion)
+		record.App = appName
+		record.Version = targetVersion.String()
+		record.Source = definition.Source()
+		record.Nomad = fmt.Sprint(configuration.Version)
+
+		//Any failure below restores previous folder, symlink and binary (even after a crash, see Recover)
+		journal, err := state.StartJournal(configuration.AppPath, "install", appName, appNameWithVersion)
+		if err != nil {
+			return err, "Cannot start install journal", EXIT_INSTALL_UPDATE_ERROR
+		}
+		tx := newTransaction(logger, journal)
+		defer tx.rollback() //nothing to undo once committed
+
+		//A new version is prepared aside, thus never seen half populated
+		workingFolder := targetAppPath
+		extract := needsExtraction(logger, targetAppPath, forceExtract)
+		if extract {
+			workingFolder = stagingFolder(appNameWithVersion)
+			if err := tx.begin(stepStage, map[string]string{"staging": workingFolder}); err != nil {
+				return err, "Cannot install/update app", EXIT_INSTALL_UPDATE_ERROR
+			}
+			if err := prepareStaging(logger, workingFolder); err != nil {
+				return err, "Cannot install/update app", EXIT_INSTALL_UPDATE_ERROR
+			}
+			defer func() {
+				if err := os.RemoveAll(workingFolder); err != nil {
+					logger.Warnln("Cannot remove", workingFolder, "|", err)
+				}
+			}()
+		}
+
 		//Extract
-		if err := getAndExtractAppIfNeeded(appState, forceExtract, skipDownload, targetAppPath, archivesDir, appNameWithVersion, definition); err != nil {
+		if err := getAndExtractAppIfNeeded(ctx, logger, appState, &record, extract, skipDownload, workingFolder, archivesDir, appNameWithVersion, definition); err != nil {
+			if ctx.Err() != nil {
+				return err, "Install/update canceled", EXIT_CANCELED
+			}
 			return err, "Cannot install/update app", EXIT_INSTALL_UPDATE_ERROR
 		}
 
+		//Persisted data seeded by this install is not kept on failure
+		if dataFolder := dataDirectory(appName); len(definition.Persist) > 0 && !helper.FileOrDirExists(dataFolder) {
+			if err := tx.begin(stepData, map[string]string{"data": dataFolder}); err != nil {
+				return err, "Cannot install/update app", EXIT_INSTALL_UPDATE_ERROR
+			}
+			tx.onRollback(fmt.Sprint("remove ", dataFolder), removeAll(dataFolder))
+		}
+
 		//Custom file actions
-		handleRestoreAndCustomFiles(appState, targetAppPath)
+		restored, err := handleRestoreAndCustomFiles(logger, tx, *appState, workingFolder, targetAppPath)
+		if err != nil {
+			return err, fmt.Sprint("Cannot persist ", definition.Persist), EXIT_INSTALL_UPDATE_ERROR
+		}
+		if appState.Status != state.KEEP {
+			record.RestoredFiles = restored
+		}
+
+		//Last chance to cancel, once promoted the (short) remaining steps are done
+		if err := ctx.Err(); err != nil {
+			return err, "Install/update canceled", EXIT_CANCELED
+		}
+
+		//Complete version replaces former one (if any) at once
+		var previous string
+		if extract {
+			if previous, err = promote(logger, tx, workingFolder, targetAppPath); err != nil {
+				return err, "Cannot install/update app", EXIT_INSTALL_UPDATE_ERROR
+			}
+		}
 
 		//Symlink
-		symlink, err := handleSymlink(appState, targetAppPath)
+		symlink, err := handleSymlink(logger, tx, *appState, targetAppPath, record.Signed)
 		if err != nil {
 			return err, "Symlink issue", EXIT_SYMLINK_ERROR
 		}
 
-		//Shortcut
-		//Update placeholder for shortcut
-		appState.Definition.Shortcut = appState.TargetVersion.FillVersionsPlaceholders(appState.Definition.Shortcut)
-		if err = handleShortcut(*definition, symlink, customAppLocationForShortcut, configuration.DefaultShortcutsDir); err != nil {
+		//Shortcut (placeholders filled in a copy, definition is shared)
+		shortcutDefinition := *definition
+		shortcutDefinition.Shortcut = fill(logger, definition.Shortcut, renderValues(*definition, targetVersion, targetAppPath))
+		if err = handleShortcut(logger, shortcutDefinition, symlink, customAppLocationForShortcut, configuration.DefaultShortcutsDir); err != nil {
 			return err, fmt.Sprint("Cannot create shortcut dir ", configuration.DefaultShortcutsDir), EXIT_SHORTCUT_ERROR
 		}
 
-		log.Infoln(appState.SuccessMessage())
+		tx.commit()
+
+		//Former content of a forced version
+		if previous != "" {
+			if err := os.RemoveAll(previous); err != nil {
+				logger.Warnln("Cannot remove", previous, "|", err)
+			}
+		}
+
+		//Not fatal, app is installed (folder name will be used to identify it)
+		if err := state.RecordInstall(configuration.AppPath, appNameWithVersion, record); err != nil {
+			logger.Warnln("Cannot record install state |", err)
+		}
+
+		logger.Infoln(appState.SuccessMessage())
 	} else {
-		log.Warnln("nothing to do (use -refresh or -force to regenerate stuff for current version)")
+		logger.Warnln("nothing to do (use -refresh or -force to regenerate stuff for current version)")
 	}
 
 	return nil, "", EXIT_OK
 
 }
 
-func handleShortcut(definition data.AppDefinition, symlink string, customAppLocationForShortcut string, shortcutDir string) error {
+func handleShortcut(logger *log.Logger, definition data.AppDefinition, symlink string, customAppLocationForShortcut string, shortcutDir string) error {
 	if definition.Shortcut != "" {
 
 		if !helper.FileOrDirExists(shortcutDir) {
-			log.Debugln("Creating shortcutDir ", shortcutDir)
-			err := os.Mkdir(shortcutDir, os.ModePerm)
+			logger.Debugln("Creating shortcutDir ", shortcutDir)
+			err := os.MkdirAll(shortcutDir, os.ModePerm)
 			if err != nil {
 				return err
 			}
@@ -135,8 +233,8 @@ func handleShortcut(definition data.AppDefinition, symlink string, customAppLoca
 			icon = path.Join(path.Dir(targetForShortcut), definition.ShortcutIcon)
 		}
 
-		log.Debugln("Creating shortcut ", definition.Shortcut, " -> ", targetForShortcut)
-		createShortcut(
+		logger.Debugln("Creating shortcut ", definition.Shortcut, " -> ", targetForShortcut)
+		createShortcut(logger,
 			filepath.Base(definition.Shortcut),
 			targetForShortcut,
 			"",
@@ -148,64 +246,91 @@ func handleShortcut(definition data.AppDefinition, symlink string, customAppLoca
 	return nil
 }
 
-func handleRestoreAndCustomFiles(appState state.AppState, workingFolder string) {
+// handleRestoreAndCustomFiles returns restored files (from previous version)
+// Files are written in workingFolder (staging, or app folder on refresh) while templates see the final appFolder
+// Only a persist failure is returned (links are undone by tx rollback)
+func handleRestoreAndCustomFiles(logger *log.Logger, tx *transaction, appState state.AppState, workingFolder string, appFolder string) (restored []string, err error) {
 
 	definition := appState.Definition
 	if appState.Status != state.KEEP {
-		log.Traceln("Restoring files folders:", definition.RestoreFiles)
-		if err := restoreFiles(definition.RestoreFiles, appState.CurrentVersionFolder, workingFolder); err != nil {
-			log.Errorln("Error restoring files:", definition.RestoreFiles, "|", err)
+		files := notPersisted(*definition)
+		logger.Traceln("Restoring files folders:", files)
+		if restored, err = restoreFiles(logger, files, appState.CurrentVersionFolder, workingFolder); err != nil {
+			logger.Errorln("Error restoring files:", files, "|", err)
 		}
 	} else {
-		log.Debugln("No version change, skipping restore")
+		logger.Debugln("No version change, skipping restore")
+	}
+
+	//Links are checked even without version change (refresh)
+	logger.Traceln("Persisting:", definition.Persist)
+	if err := persistData(logger, tx, *definition, appState.CurrentVersionFolder, workingFolder); err != nil {
+		return restored, err
 	}
 
-	log.Traceln("Creating folders:", definition.CreateFolders)
+	logger.Traceln("Creating folders:", definition.CreateFolders)
 	if err := createFolders(definition.CreateFolders, workingFolder); err != nil {
-		log.Errorln("Error creating folders:", definition.CreateFolders, "|", err)
+		logger.Errorln("Error creating folders:", definition.CreateFolders, "|", err)
 	}
 
-	log.Traceln("Creating files:", definition.CreateFiles)
-	absoluteSymlinkToApp, _ := filepath.Abs(filepath.Join(configuration.AppPath, appState.Definition.Symlink))
-	if err := writeScripts(definition.CreateFiles, workingFolder, absoluteSymlinkToApp, appState.TargetVersion); err != nil {
-		log.Errorln("Error creating files:", definition.CreateFiles, "|", err)
+	logger.Traceln("Creating files:", definition.CreateFiles)
+	values := renderValues(*definition, appState.TargetVersion, appFolder)
+	if err := writeScripts(logger, definition.CreateFiles, workingFolder, values, definition.OverwriteFiles); err != nil {
+		logger.Errorln("Error creating files:", definition.CreateFiles, "|", err)
 	}
 
-	log.Traceln("Moving objects:", definition.MoveObjects)
+	logger.Traceln("Moving objects:", definition.MoveObjects)
 	if err := moveObjects(definition.MoveObjects, workingFolder); err != nil {
-		log.Errorln("Error moving objects:", definition.MoveObjects, "|", err)
+		logger.Errorln("Error moving objects:", definition.MoveObjects, "|", err)
 	}
+	return restored, nil
 }
 
-func handleSymlink(appState state.AppState, newTarget string) (string, error) {
+// handleSymlink points app symlink to newTarget (and updates nomad binary), changes are undone by tx rollback
+// signed tells if newTarget archive signature was verified (required to replace nomad binary)
+func handleSymlink(logger *log.Logger, tx *transaction, appState state.AppState, newTarget string, signed bool) (string, error) {
 	//create/update symlink app-1.0.2 => app ...
 	symlink := filepath.Join(configuration.AppPath, appState.Definition.Symlink)
-	log.Debugln("Handling symlink", symlink, "(already discovered:", appState.SymlinkFound, ")")
+	logger.Debugln("Handling symlink", symlink, "(already discovered:", appState.SymlinkFound, ")")
 
 	absoluteTarget, _ := filepath.Abs(newTarget)
-	if absoluteTarget != helper.GetSymlinkTarget(symlink) {
+	if previousTarget := helper.GetSymlinkTarget(symlink); absoluteTarget != previousTarget {
 		if appState.SymlinkFound || helper.SymlinkPointsToUnknownTarget(symlink) {
 			//Remove old
 			err := os.Remove(symlink)
 			if err != nil {
-				log.Errorln("Cannot remove symlink ", symlink, "|", err)
+				logger.Errorln("Cannot remove symlink ", symlink, "|", err)
 			} else {
-				log.Debugln("Removed symlink", symlink)
+				logger.Debugln("Removed symlink", symlink)
 			}
 		} else if reflect.DeepEqual(appState.CurrentVersion, appState.TargetVersion) { /*no symlink and same version,... */
-			log.Infoln("missing symlink", symlink, "will be regenerated")
+			logger.Infoln("missing symlink", symlink, "will be regenerated")
 		}
 
 		//SYMLINK
-		log.Debugln("Linking " + symlink + " -> " + newTarget)
+		logger.Debugln("Linking " + symlink + " -> " + newTarget)
+		if err := tx.begin(stepSymlink, map[string]string{"symlink": symlink, "target": absoluteTarget, "previousTarget": previousTarget}); err != nil {
+			return symlink, err
+		}
 
 		//TODO detect filesystem without symlink support (exfat...) https://github.com/jonathanMelly/nomad/issues/44
-		err := junction.Create(newTarget, symlink)
+		//Absolute target as a relative one would be resolved from symlink directory (unix)
+		err := junction.Create(absoluteTarget, symlink)
 		if err != nil {
 			return symlink, errors.New(fmt.Sprint("Error symlink/junction to ", newTarget, " | ", err))
 		}
+		tx.onRollback(fmt.Sprint("relink ", symlink, " -> ", previousTarget), func() error {
+			if err := os.Remove(symlink); err != nil {
+				return err
+			}
+			if previousTarget == "" {
+				return nil
+			}
+			return junction.Create(previousTarget, symlink)
+		})
+		tx.applied()
 	} else {
-		log.Debugln("symlink", symlink, "already pointing to", newTarget)
+		logger.Debugln("symlink", symlink, "already pointing to", newTarget)
 	}
 
 	//handle special nomad symlink
@@ -229,30 +354,29 @@ func handleSymlink(appState state.AppState, newTarget string) (string, error) {
 			return "Cannot compare nomad binary versions", err
 		} else if !sameVersion {
 
-			log.Trace("try replacing nomad binary with latest installed")
-
-			oldVersion := fmt.Sprint(currentBinaryPath, ".", appState.CurrentVersion)
-			err := os.Rename(currentBinaryPath, oldVersion)
-			if err != nil {
-				return fmt.Sprint("Cannot rename old nomad binary to", oldVersion), err
+			if !signed {
+				return "Refusing to replace nomad binary with an unsigned one", errors.New(fmt.Sprint("archive signature of ", newTarget, " was not verified"))
 			}
 
-			newBinary, err := os.Create(currentBinaryPath)
-			if err != nil {
-				rollbackRename(oldVersion, currentBinaryPath)
-				return "Cannot create new binary", err
-			}
-			targetBinary, err := os.Open(targetBinaryPath)
-			if err != nil {
-				rollbackRename(oldVersion, currentBinaryPath)
-				return fmt.Sprint("Cannot open target binary", targetBinary), err
+			logger.Trace("try replacing nomad binary with latest installed")
+			oldVersion := fmt.Sprint(currentBinaryPath, ".", appState.CurrentVersion)
+			absoluteBinary, _ := filepath.Abs(currentBinaryPath)
+			absoluteOldVersion, _ := filepath.Abs(oldVersion)
+			absoluteTargetBinary, _ := filepath.Abs(targetBinaryPath)
+			if err := tx.begin(stepBinary, map[string]string{"binary": absoluteBinary, "oldBinary": absoluteOldVersion, "newBinary": absoluteTargetBinary}); err != nil {
+				return "Cannot replace nomad binary", err
 			}
-			_, err = io.Copy(newBinary, targetBinary)
-			if err != nil {
-				rollbackRename(oldVersion, currentBinaryPath)
-				return fmt.Sprint("Cannot copy ", targetBinary, " content to ", newBinary), err
+			if err := replaceBinary(logger, currentBinaryPath, targetBinaryPath, oldVersion); err != nil {
+				return "Cannot replace nomad binary", err
 			}
-			log.Traceln("ok")
+			tx.onRollback(fmt.Sprint("restore nomad binary ", oldVersion), func() error {
+				if err := os.Remove(currentBinaryPath); err != nil {
+					return err
+				}
+				return os.Rename(oldVersion, currentBinaryPath)
+			})
+			tx.applied()
+			logger.Traceln("ok")
 
 		}
 	}
@@ -260,35 +384,70 @@ func handleSymlink(appState state.AppState, newTarget string) (string, error) {
 	return symlink, nil
 }
 
-func rollbackRename(oldVersion string, currentBinaryPath string) {
+// replaceBinary copies newBinaryPath over binaryPath, renamed to oldVersion (running binary can be renamed, not overwritten)
+func replaceBinary(logger *log.Logger, binaryPath string, newBinaryPath string, oldVersion string) error {
+	err := os.Rename(binaryPath, oldVersion)
+	if err != nil {
+		return errors.New(fmt.Sprint("Cannot rename old nomad binary to ", oldVersion, " | ", err))
+	}
+
+	if err := copyBinary(newBinaryPath, binaryPath); err != nil {
+		//Partial copy must go before previous binary gets its name back
+		if err := os.Remove(binaryPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Errorln("Cannot remove partial binary", binaryPath, "|", err)
+		}
+		rollbackRename(logger, oldVersion, binaryPath)
+		return err
+	}
+	return nil
+}
+
+// copyBinary writes an executable copy of sourcePath
+func copyBinary(sourcePath string, destinationPath string) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return errors.New(fmt.Sprint("Cannot open target binary ", sourcePath, " | ", err))
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(destinationPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return errors.New(fmt.Sprint("Cannot create new binary | ", err))
+	}
+	if _, err = io.Copy(destination, source); err != nil {
+		_ = destination.Close()
+		return errors.New(fmt.Sprint("Cannot copy ", sourcePath, " content to ", destinationPath, " | ", err))
+	}
+	return destination.Close()
+}
+
+func rollbackRename(logger *log.Logger, oldVersion string, currentBinaryPath string) {
 	//try to rollback
 	err := os.Rename(oldVersion, currentBinaryPath)
 	if err != nil {
-		log.Errorln("Cannot rollback nomad to previous version", err)
+		logger.Errorln("Cannot rollback nomad to previous version", err)
 	}
 }
 
 func getAndExtractAppIfNeeded(
-	appState state.AppState,
-	forceExtract bool,
+	ctx context.Context,
+	logger *log.Logger,
+	appState *state.AppState,
+	record *state.InstallRecord,
+	extract bool,
 	skipDownload bool,
-	targetAppPath string,
+	workingFolder string,
 	archivesDir string,
 	appNameWithVersion string,
 	definition *data.AppDefinition,
 ) error {
 
-	needsExtraction, err := checkAndEraseCurrentVersionIfNeeded(targetAppPath, forceExtract)
-	if err != nil {
-		return err
-	}
-
-	if needsExtraction {
-		log.Debugln("Preparing for extraction")
+	if extract {
+		logger.Debugln("Preparing for extraction")
 
 		//Create archives base directory if needed (only first time)
 		if !helper.FileOrDirExists(archivesDir) {
-			log.Traceln("Creating archive dir", archivesDir)
+			logger.Traceln("Creating archive dir", archivesDir)
 			err := os.MkdirAll(archivesDir, os.ModePerm)
 			if err != nil {
 				return errors.New(fmt.Sprint("Cannot create ", archivesDir))
@@ -296,15 +455,22 @@ func getAndExtractAppIfNeeded(
 		}
 
 		//Get downloadURL (from human if needed)
-		downloadURL := appState.TargetVersion.FillVersionsPlaceholders(definition.DownloadUrl)
+		values := renderValues(*definition, appState.TargetVersion, path.Join(configuration.AppPath, appNameWithVersion))
+		downloadURL, err := render.String(definition.DownloadUrl, values)
+		if err != nil {
+			return errors.New(fmt.Sprint("Cannot render download URL | ", err))
+		}
 		if strings.HasPrefix(downloadURL, "manual") {
+			//One question at a time (-jobs), shown even if app logs are grouped
+			promptMutex.Lock()
 			scanner := bufio.NewScanner(os.Stdin)
-			log.Print("Please paste custom URL for download (", downloadURL, ") :")
+			log.Print(helper.BuildPrefix(appState.Definition.ApplicationName), "Please paste custom URL for download (", downloadURL, ") :")
 			scanner.Scan()
 			answer := scanner.Text()
-			log.Debugln("Custom URL", answer)
+			promptMutex.Unlock()
+			logger.Debugln("Custom URL", answer)
 
-			downloadURL = appState.TargetVersion.FillVersionsPlaceholders(answer)
+			downloadURL = fill(logger, answer, values)
 			definition.DownloadUrl = downloadURL
 			definition.ComputeDownloadExtension()
 		}
@@ -313,97 +479,139 @@ func getAndExtractAppIfNeeded(
 		// Note: The original file download name will be changed
 		var archivePath = path.Join(archivesDir, fmt.Sprint(appNameWithVersion, definition.DownloadExtension))
 
-		err := downloadArchive(downloadURL, skipDownload, archivePath, definition.SslIgnoreBadCert)
+		checksum, err := archiveChecksum(ctx, logger, *definition, appState.TargetVersion, downloadURL)
 		if err != nil {
-			downloadedFile, err := os.Stat(archivePath)
-			if err != nil {
-				if downloadedFile.Size() == 0 {
-					err := os.Remove(downloadedFile.Name())
-					if err != nil {
-						log.Warnln("Cannot remove empty file", downloadedFile.Name(), "|", err)
-					} else {
-						log.Debugln("Removed empty file", downloadedFile.Name())
-					}
+			return errors.New(fmt.Sprint("Cannot get archive checksum | ", err))
+		}
+		downloaded, err := downloadArchive(ctx, logger, downloadURL, skipDownload, archivePath, checksum, definition.SslIgnoreBadCert)
+		appState.Downloaded = downloaded
+		if err != nil {
+			if downloadedFile, statErr := os.Stat(archivePath); statErr == nil && downloadedFile.Size() == 0 {
+				if removeErr := os.Remove(archivePath); removeErr != nil {
+					logger.Warnln("Cannot remove empty file", archivePath, "|", removeErr)
+				} else {
+					logger.Debugln("Removed empty file", archivePath)
 				}
 			}
 			return errors.New(fmt.Sprint("Cannot download archive | ", err))
 		}
 
+		//Signature (checked once, result recorded for nomad binary replacement)
+		record.Signed = false
+		if signature := archiveSignature(*appState); signature.IsSet() || definition.ApplicationName == "nomad" {
+			if err := verifySignature(ctx, logger, archivePath, signature, downloadURL, definition.SslIgnoreBadCert); err != nil {
+				var extra string
+				if errors.Is(err, errBadSignature) {
+					extra = quarantineArchive(logger, archivePath)
+				}
+				return errors.New(fmt.Sprint("Cannot verify archive signature", extra, " | ", err))
+			}
+			record.Signed = true
+		}
+
+		//Frozen install
+		if appState.Locked != nil {
+			if err := verifyLockedArchive(logger, archivePath, *appState.Locked); err != nil {
+				return errors.New(fmt.Sprint("Archive does not match ", configuration.LockFileName, quarantineArchive(logger, archivePath), " | ", err))
+			}
+		}
+
 		//Extract
-		log.Debugln("Extracting files from ", archivePath)
-		err = extractArchive(archivePath, *definition, targetAppPath)
+		logger.Debugln("Extracting files from ", archivePath)
+		rendered := *definition //asset names come from the real URL
+		rendered.DownloadUrl = downloadURL
+		err = extractArchive(ctx, logger, archivePath, rendered, workingFolder)
 		if err != nil {
 			var extra string
-			if errors.Is(err, zip.ErrFormat) {
-				datetimeStr := time.Now().Format("2006-01-02X15_04_05")
-				newPath := fmt.Sprint(archivePath, "-", datetimeStr, ".bad")
-				err2 := os.Rename(archivePath, newPath)
-
-				if err2 == nil {
-					extra = fmt.Sprint(" (archive moved to ", newPath, " )")
-				} else {
-					log.Warnln("cannot move bad archive to", newPath, "|", err2)
-				}
+			if errors.Is(err, zip.ErrFormat) || errors.Is(err, errInvalidArchive) {
+				extra = quarantineArchive(logger, archivePath)
 			}
 			return errors.New(fmt.Sprint("Error extracting from archive ", extra, " | ", err))
 		}
+
+		record.DownloadUrl = downloadURL
+		record.InstalledAt = time.Now()
+		if record.Sha256, err = helper.Sha256(archivePath); err != nil {
+			logger.Warnln("Cannot hash", archivePath, "|", err)
+		}
 	} else {
-		log.Infoln("directory", targetAppPath, "already exists (use -force to regenerate from archive)")
+		logger.Infoln("directory", workingFolder, "already exists (use -force to regenerate from archive)")
 	}
 	return nil
 }
 
-func checkAndEraseCurrentVersionIfNeeded(appPath string, forceExtract bool) (bool, error) {
-	log.Debugln("Checking ", appPath)
+// needsExtraction tells if a version folder must be (re)extracted (replaced folder is kept until promote)
+func needsExtraction(logger *log.Logger, appPath string, forceExtract bool) bool {
+	logger.Debugln("Checking ", appPath)
 	extract := true
 	// If the folder exists
 	if helper.FileOrDirExists(appPath) {
 		if helper.IsDirectory(appPath) {
 			if forceExtract {
-				log.Infoln("Removing old version:", appPath, " (as force extract asked)")
-				err := os.RemoveAll(appPath)
-				if err != nil {
-					return false, errors.New(fmt.Sprint("Error removing working folder |", err))
-				}
+				logger.Infoln("Replacing old version:", appPath, " (as force extract asked)")
 			} else {
-				log.Traceln("Directory ", appPath, " already exists, letting original content unmodified (use -force)")
+				logger.Traceln("Directory ", appPath, " already exists, letting original content unmodified (use -force)")
 				extract = false
 			}
 		} else {
-			log.Warnln("/!\\WARNINIG, filename (not directory) ", appPath, " already exists. Please remove it manually")
+			logger.Warnln("/!\\WARNINIG, filename (not directory) ", appPath, " already exists. Please remove it manually")
 			extract = false
 		}
 	}
-	return extract, nil
+	return extract
 }
 
-func downloadArchive(downloadURL string, skipDownload bool, archivePath string, ignoreBadCert bool) error {
+// downloadArchive gets archive (if needed) and verifies it against checksum (if any)
+// An archive not matching checksum is quarantined
+// Returns downloaded size (0 if already downloaded archive is reused)
+func downloadArchive(ctx context.Context, logger *log.Logger, downloadURL string, skipDownload bool, archivePath string, checksum string, ignoreBadCert bool) (downloaded int64, err error) {
 	if skipDownload && helper.FileOrDirExists(archivePath) {
-		log.Infoln("Using already downloaded", archivePath, "(use -force to override)")
+		logger.Infoln("Using already downloaded", archivePath, "(use -force to override)")
 	} else {
-		log.Infoln("Downloading", downloadURL, "to", archivePath, "...")
-		_spinner := spinner.New(spinner.CharSets[59], 300*time.Millisecond) // Build our new _spinner
-		_spinner.Prefix = "Please wait while downloading file "
-		_spinner.Start()
-		size, err := helper.DownloadFile(downloadURL, archivePath, ignoreBadCert)
-		_spinner.Stop()
+		logger.Infoln("Downloading", downloadURL, "to", archivePath, "...")
+		size, err := helper.DownloadFile(ctx, logger, downloadURL, archivePath, ignoreBadCert)
 		if err != nil {
-			return errors.New(fmt.Sprint("Error download file ", err))
+			return 0, errors.New(fmt.Sprint("Error download file ", err))
 		}
-		log.Traceln("Downloaded size:", bytesize.ByteSize(size))
+		logger.Traceln("Downloaded size:", bytesize.ByteSize(size))
+		downloaded = size
 	}
-	return nil
+
+	if checksum != "" {
+		if err := verifyChecksum(ctx, logger, archivePath, checksum, downloadURL, ignoreBadCert); err != nil {
+			if errors.Is(err, errChecksumMismatch) {
+				return downloaded, errors.New(fmt.Sprint(err.Error(), quarantineArchive(logger, archivePath)))
+			}
+			return downloaded, errors.New(fmt.Sprint("Cannot verify checksum | ", err))
+		}
+	}
+	return downloaded, nil
 }
 
-func userWantsToContinue(askForConfirmation bool) bool {
-	if askForConfirmation {
-		scanner := bufio.NewScanner(os.Stdin)
-		log.Print("Proceed [Y,n] (Enter=Yes) ? ")
-		scanner.Scan()
-		answer := scanner.Text()
-		log.Debugln("Answer", answer)
-		return answer == "" || strings.ToLower(answer) == "y"
+// quarantineArchive renames a bad archive (so that it won't be reused) and returns a message part telling where it is
+func quarantineArchive(logger *log.Logger, archivePath string) string {
+	datetimeStr := time.Now().Format("2006-01-02X15_04_05")
+	newPath := fmt.Sprint(archivePath, "-", datetimeStr, ".bad")
+	if err := os.Rename(archivePath, newPath); err != nil {
+		logger.Warnln("cannot move bad archive to", newPath, "|", err)
+		return ""
+	}
+	return fmt.Sprint(" (archive moved to ", newPath, " )")
+}
 
+// UserWantsToContinue asks for confirmation only if needed
+func UserWantsToContinue(askForConfirmation bool) bool {
+	if askForConfirmation {
+		return userAgrees("Proceed")
 	}
-	return false
+	return true
+}
+
+func userAgrees(question string) bool {
+	scanner := bufio.NewScanner(os.Stdin)
+	log.Print(question, " [Y,n] (Enter=Yes) ? ")
+	scanner.Scan()
+	answer := scanner.Text()
+	log.Debugln("Answer", answer)
+	return answer == "" || strings.ToLower(answer) == "y"
 }
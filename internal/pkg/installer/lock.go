@@ -0,0 +1,165 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/render"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Lock resolves target versions of apps to exact archives (downloaded if needed to get size and sha256)
+// and writes them to lockPath. If update is set, other apps already in lockPath are kept.
+func Lock(ctx context.Context, states state.AppStates, archivesSubDir string, skipDownload bool, lockPath string, update bool) (err error, errorMessage string, exitCode int) {
+	lockFile := data.LockFile{Nomad: fmt.Sprint(configuration.Version), Apps: map[string]data.LockedApp{}}
+	if update && helper.FileOrDirExists(lockPath) {
+		existing, err := ReadLockFile(lockPath)
+		if err != nil {
+			return err, fmt.Sprint("Cannot read ", lockPath), EXIT_LOCK_ERROR
+		}
+		lockFile.Apps = existing.Apps
+	}
+
+	apps := make([]string, 0, len(states))
+	for app := range states {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	var _errors []error
+	for _, app := range apps {
+		logger := states[app].Logger()
+		locked, err := lockApp(ctx, logger, *states[app], path.Join(configuration.AppPath, archivesSubDir), skipDownload)
+		if err != nil {
+			logger.Errorln("Cannot lock |", err)
+			_errors = append(_errors, fmt.Errorf("%s: %w", app, err))
+			continue
+		}
+		logger.Infoln("locked version", locked.Version, "sha256", locked.Sha256)
+		lockFile.Apps[app] = locked
+	}
+
+	//A partial lock file would be misleading
+	if err := errors.Join(_errors...); err != nil {
+		return err, fmt.Sprint(lockPath, " not written"), EXIT_LOCK_ERROR
+	}
+
+	if err := WriteLockFile(lockPath, lockFile); err != nil {
+		return err, fmt.Sprint("Cannot write ", lockPath), EXIT_LOCK_ERROR
+	}
+	log.Infoln(len(apps), "apps locked in", lockPath)
+	return nil, "", EXIT_OK
+}
+
+func lockApp(ctx context.Context, logger *log.Logger, appState state.AppState, archivesDir string, skipDownload bool) (data.LockedApp, error) {
+	definition := appState.Definition
+	if valid, err := definition.IsValid(); !valid {
+		return data.LockedApp{}, err
+	}
+	if appState.TargetVersion == nil {
+		return data.LockedApp{}, errors.New("cannot determine version")
+	}
+
+	downloadURL, err := render.String(definition.DownloadUrl, renderValues(*definition, appState.TargetVersion, ""))
+	if err != nil {
+		return data.LockedApp{}, err
+	}
+	if strings.HasPrefix(downloadURL, "manual") {
+		return data.LockedApp{}, errors.New("manual download URL cannot be locked")
+	}
+
+	if !helper.FileOrDirExists(archivesDir) {
+		if err := os.MkdirAll(archivesDir, os.ModePerm); err != nil {
+			return data.LockedApp{}, err
+		}
+	}
+	archivePath := path.Join(archivesDir, fmt.Sprint(definition.ApplicationName, "-", appState.TargetVersion, definition.DownloadExtension))
+	checksum, err := archiveChecksum(ctx, logger, *definition, appState.TargetVersion, downloadURL)
+	if err != nil {
+		return data.LockedApp{}, fmt.Errorf("cannot get archive checksum | %w", err)
+	}
+	if _, err := downloadArchive(ctx, logger, downloadURL, skipDownload, archivePath, checksum, definition.SslIgnoreBadCert); err != nil {
+		return data.LockedApp{}, err
+	}
+
+	hash, err := helper.Sha256(archivePath)
+	if err != nil {
+		return data.LockedApp{}, err
+	}
+
+	return data.LockedApp{
+		Version:     appState.TargetVersion.String(),
+		DownloadUrl: downloadURL,
+		Size:        helper.Size(archivePath),
+		Sha256:      hash,
+	}, nil
+}
+
+// Freeze pins states to lock file entries (replaces remote version checks)
+func Freeze(states state.AppStates, lockFile data.LockFile) error {
+	var _errors []error
+	for app, appState := range states {
+		locked, found := lockFile.Apps[app]
+		if !found {
+			_errors = append(_errors, errors.New(fmt.Sprint(app, " not found in lock file")))
+			continue
+		}
+		lockedVersion, err := version.FromString(locked.Version)
+		if err != nil {
+			_errors = append(_errors, fmt.Errorf("%s: bad locked version %s | %w", app, locked.Version, err))
+			continue
+		}
+		//Defaults (github url...) must be computed before overriding download url
+		if valid, err := appState.Definition.IsValid(); !valid {
+			_errors = append(_errors, fmt.Errorf("%s: %w", app, err))
+			continue
+		}
+
+		appState.Definition.DownloadUrl = locked.DownloadUrl
+		appState.SetTargetVersion(lockedVersion)
+		appState.Locked = &locked
+	}
+	return errors.Join(_errors...)
+}
+
+func verifyLockedArchive(logger *log.Logger, archivePath string, locked data.LockedApp) error {
+	if size := helper.Size(archivePath); size != locked.Size {
+		return errors.New(fmt.Sprint("size mismatch, expected ", locked.Size, " got ", size))
+	}
+	hash, err := helper.Sha256(archivePath)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(hash, locked.Sha256) {
+		return errors.New(fmt.Sprint("sha256 mismatch, expected ", locked.Sha256, " got ", hash))
+	}
+	logger.Debugln("Archive matches locked sha256", hash)
+	return nil
+}
+
+func ReadLockFile(lockPath string) (lockFile data.LockFile, err error) {
+	content, err := os.ReadFile(lockPath)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &lockFile)
+	return
+}
+
+func WriteLockFile(lockPath string, lockFile data.LockFile) error {
+	content, err := json.MarshalIndent(lockFile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(lockPath, append(content, '\n'), 0644)
+}
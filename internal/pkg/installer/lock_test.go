@@ -0,0 +1,52 @@
+package installer
+
+import (
+	"github.com/gologme/log"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockFileRoundTrip(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "nomad.lock")
+	lockFile := data.LockFile{Nomad: "1.0.0", Apps: map[string]data.LockedApp{
+		"app": {Version: "2.0.0", DownloadUrl: "https://example.org/app-2.0.0.zip", Size: 3, Sha256: "abc"},
+	}}
+
+	assert.NoError(t, WriteLockFile(lockPath, lockFile))
+	read, err := ReadLockFile(lockPath)
+	assert.NoError(t, err)
+	assert.Equal(t, lockFile, read)
+}
+
+func TestFreeze(t *testing.T) {
+	lockFile := data.LockFile{Apps: map[string]data.LockedApp{
+		"app": {Version: "2.0.0", DownloadUrl: "https://example.org/final/app-2.0.0.zip"},
+	}}
+
+	states := state.AppStates{"app": &state.AppState{Definition: &data.AppDefinition{
+		ApplicationName: "app",
+		Version:         "1.0.0",
+		DownloadUrl:     "https://example.org/app-{{VERSION}}.zip",
+	}}}
+	assert.NoError(t, Freeze(states, lockFile))
+	assert.Equal(t, "2.0.0", states["app"].TargetVersion.String())
+	assert.Equal(t, state.INSTALL, states["app"].Status)
+	assert.Equal(t, "https://example.org/final/app-2.0.0.zip", states["app"].Definition.DownloadUrl)
+	assert.NotNil(t, states["app"].Locked)
+
+	states["other"] = &state.AppState{Definition: &data.AppDefinition{ApplicationName: "other", Version: "1.0.0"}}
+	assert.ErrSubMsg(t, Freeze(states, lockFile), "other not found")
+}
+
+func Test_verifyLockedArchive(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "app-2.0.0.zip")
+	assert.NoError(t, os.WriteFile(archive, []byte("abc"), os.ModePerm))
+
+	assert.NoError(t, verifyLockedArchive(log.Default(), archive, data.LockedApp{Size: 3, Sha256: abcSha256}))
+	assert.ErrSubMsg(t, verifyLockedArchive(log.Default(), archive, data.LockedApp{Size: 4, Sha256: abcSha256}), "size mismatch")
+	assert.ErrSubMsg(t, verifyLockedArchive(log.Default(), archive, data.LockedApp{Size: 3, Sha256: "00"}), "sha256 mismatch")
+}
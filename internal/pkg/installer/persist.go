@@ -0,0 +1,217 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	junction "github.com/nyaosorg/go-windows-junction"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// dataDirectory returns where persisted paths of an app live (outside version folders)
+func dataDirectory(appName string) string {
+	return filepath.Join(configuration.AppPath, fmt.Sprint(appName, configuration.DataDirectorySuffix))
+}
+
+// notPersisted filters out restore files handled by Persist (they are linked, not copied)
+func notPersisted(definition data.AppDefinition) (files []string) {
+	persisted := map[string]bool{}
+	for _, file := range definition.Persist {
+		persisted[filepath.Clean(file)] = true
+	}
+	for _, file := range definition.RestoreFiles {
+		if !persisted[filepath.Clean(file)] {
+			files = append(files, file)
+		}
+	}
+	return
+}
+
+// persistData links persisted folders of versionFolder to the app data directory
+// A missing data folder is first taken from previous version (migration of RestoreFiles content),
+// else from archive content (defaults), else created empty
+// Each folder is a step of tx (replaced archive content is kept aside until commit, see unpersist)
+func persistData(logger *log.Logger, tx *transaction, definition data.AppDefinition, previousVersionFolder string, versionFolder string) error {
+	dataDir := dataDirectory(definition.ApplicationName)
+	var _errors []error
+	for _, persisted := range definition.Persist {
+		if err := persistFolder(logger, tx, filepath.Join(dataDir, persisted), previousVersionFolder, persisted, filepath.Join(versionFolder, persisted)); err != nil {
+			_errors = append(_errors, err)
+		}
+	}
+	return errors.Join(_errors...)
+}
+
+func persistFolder(logger *log.Logger, tx *transaction, dataPath string, previousVersionFolder string, persisted string, linkPath string) error {
+	absoluteData, _ := filepath.Abs(dataPath)
+	if helper.FileOrDirExists(dataPath) && helper.GetSymlinkTarget(linkPath) == absoluteData {
+		logger.Traceln(linkPath, "already linked to", dataPath)
+		return nil
+	}
+
+	//Linking a file would not survive apps saving through a temporary file (renamed over the link)
+	candidates := []string{dataPath, linkPath}
+	if previousVersionFolder != "" {
+		candidates = append(candidates, filepath.Join(previousVersionFolder, persisted))
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return errors.New(fmt.Sprint("cannot persist ", candidate, " (only folders can be persisted)"))
+		}
+	}
+
+	paths := map[string]string{"link": linkPath, "data": "", "aside": ""}
+	if !helper.FileOrDirExists(dataPath) {
+		paths["data"] = dataPath
+	}
+	//Staged content is thrown away on failure, nothing to keep aside
+	if info, err := os.Lstat(linkPath); err == nil && info.Mode()&fs.ModeSymlink == 0 && !isStaged(linkPath) {
+		paths["aside"] = fmt.Sprint(linkPath, previousSuffix)
+	}
+	if err := tx.begin(stepPersist, paths); err != nil {
+		return err
+	}
+	tx.onRollback(fmt.Sprint("unlink ", linkPath), func() error {
+		return unpersist(logger, paths["link"], paths["data"], paths["aside"])
+	})
+
+	if err := seedData(logger, dataPath, previousVersionFolder, persisted, linkPath); err != nil {
+		return fmt.Errorf("cannot prepare %s | %w", dataPath, err)
+	}
+	if err := linkData(logger, tx, absoluteData, linkPath, paths["aside"]); err != nil {
+		return fmt.Errorf("cannot link %s | %w", linkPath, err)
+	}
+	tx.applied()
+	return nil
+}
+
+const partialCopySuffix = ".part"
+
+func seedData(logger *log.Logger, dataPath string, previousVersionFolder string, persisted string, linkPath string) error {
+	if helper.FileOrDirExists(dataPath) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dataPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	//Copy (not move) to keep previous version usable (rollback)
+	if previousVersionFolder != "" {
+		previousPath := filepath.Join(previousVersionFolder, persisted)
+		absolutePrevious, _ := filepath.Abs(previousPath)
+		absoluteLink, _ := filepath.Abs(linkPath)
+		if _, err := os.Stat(previousPath); err == nil && absolutePrevious != absoluteLink {
+			logger.Infoln("Migrating", previousPath, "to", dataPath)
+			//A partial copy must not be taken for persisted data on next run
+			partialPath := dataPath + partialCopySuffix
+			if err := os.RemoveAll(partialPath); err != nil {
+				return err
+			}
+			if err := copyPath(logger, previousPath, partialPath); err != nil {
+				return err
+			}
+			return os.Rename(partialPath, dataPath)
+		}
+	}
+
+	if info, err := os.Lstat(linkPath); err == nil && info.Mode()&fs.ModeSymlink == 0 {
+		logger.Debugln("Persisting archive content", linkPath, "to", dataPath)
+		return os.Rename(linkPath, dataPath)
+	}
+
+	logger.Debugln("Creating empty", dataPath)
+	return os.MkdirAll(dataPath, os.ModePerm)
+}
+
+// linkData replaces linkPath with a link to absoluteData
+// Replaced content is moved to aside (removed once tx is committed) or removed if aside is empty
+func linkData(logger *log.Logger, tx *transaction, absoluteData string, linkPath string, aside string) error {
+	if helper.IsSymlink(linkPath) {
+		if err := os.Remove(linkPath); err != nil {
+			return err
+		}
+	} else if helper.FileOrDirExists(linkPath) {
+		//Archive content is replaced by persisted data
+		if aside == "" {
+			if err := os.RemoveAll(linkPath); err != nil {
+				return err
+			}
+		} else {
+			if err := os.RemoveAll(aside); err != nil {
+				return err
+			}
+			if err := os.Rename(linkPath, aside); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(linkPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	logger.Debugln("Linking", linkPath, "->", absoluteData)
+	if err := junction.Create(absoluteData, linkPath); err != nil {
+		return err
+	}
+	if aside != "" {
+		tx.onCommit(fmt.Sprint("remove ", aside), removeAll(aside))
+	}
+	return nil
+}
+
+// isStaged tells if path is in a version being prepared in staging folder
+func isStaged(path string) bool {
+	absoluteStaging, _ := filepath.Abs(filepath.Join(configuration.AppPath, configuration.StagingDir))
+	absolutePath, _ := filepath.Abs(path)
+	relative, err := filepath.Rel(absoluteStaging, absolutePath)
+	return err == nil && filepath.IsLocal(relative)
+}
+
+// unpersist puts back the archive content replaced by a persisted folder link and removes data seeded by persistData
+// (aside and data are empty if there was no archive content or if data already existed)
+func unpersist(logger *log.Logger, link string, data string, aside string) error {
+	if helper.IsSymlink(link) {
+		if err := os.Remove(link); err != nil {
+			return err
+		}
+	}
+	if aside != "" && helper.FileOrDirExists(aside) {
+		logger.Infoln("Restoring", link, "from", aside)
+		if err := os.Rename(aside, link); err != nil {
+			return err
+		}
+	}
+	if data == "" || !helper.FileOrDirExists(data) {
+		return nil
+	}
+	if aside != "" && !helper.FileOrDirExists(link) && helper.FileOrDirExists(filepath.Dir(link)) {
+		//Seeded with archive content
+		logger.Infoln("Restoring", link, "from", data)
+		return os.Rename(data, link)
+	}
+	logger.Infoln("Removing", data)
+	return os.RemoveAll(data)
+}
+
+// copyPath copies a file or a folder (recursively)
+func copyPath(logger *log.Logger, source string, destination string) error {
+	return filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, relativePath)
+		if entry.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		return copyFile(logger, path, target)
+	})
+}
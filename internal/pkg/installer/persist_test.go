@@ -0,0 +1,206 @@
+package installer
+
+import (
+	"context"
+	"github.com/gologme/log"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_persistData(t *testing.T) {
+	previousAppPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = previousAppPath }()
+
+	previous := filepath.Join(configuration.AppPath, "demo-1.0")
+	current := filepath.Join(configuration.AppPath, "demo-2.0")
+	assert.NoError(t, os.MkdirAll(filepath.Join(previous, "data"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(previous, "data", "config.txt"), []byte("mine"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(filepath.Join(previous, "settings"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(previous, "settings", "settings.ini"), []byte("a=1"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(filepath.Join(current, "data"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(current, "data", "default.txt"), []byte("archive"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(filepath.Join(current, "plugins"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(current, "plugins", "plugins.txt"), []byte("archive"), os.ModePerm))
+
+	definition := data.AppDefinition{ApplicationName: "demo", Persist: []string{"data", "settings", "plugins", "cache"},
+		RestoreFiles: []string{"settings", "other.ini"}}
+	assert.Eq(t, []string{"other.ini"}, notPersisted(definition))
+
+	//Twice to check it is idempotent
+	for i := 0; i < 2; i++ {
+		tx := newTransaction(log.Default(), nil)
+		assert.NoError(t, persistData(log.Default(), tx, definition, previous, current))
+		tx.commit()
+	}
+
+	dataDir := filepath.Join(configuration.AppPath, "demo-data")
+	content, err := os.ReadFile(filepath.Join(current, "data", "config.txt"))
+	assert.NoError(t, err)
+	assert.Eq(t, "mine", string(content)) //migrated from previous version
+	assert.False(t, fileExists(filepath.Join(current, "data", "default.txt")))
+	assert.False(t, fileExists(filepath.Join(current, "data"+previousSuffix))) //replaced content removed once committed
+	assert.True(t, fileExists(filepath.Join(previous, "data", "config.txt")))  //kept for rollback
+
+	content, err = os.ReadFile(filepath.Join(dataDir, "plugins", "plugins.txt"))
+	assert.NoError(t, err)
+	assert.Eq(t, "archive", string(content)) //defaults from archive
+	assert.True(t, fileExists(filepath.Join(dataDir, "cache")))
+
+	//Writes go to data directory, even through a temporary file renamed over the former one
+	temporary := filepath.Join(current, "settings", "settings.ini.tmp")
+	assert.NoError(t, os.WriteFile(temporary, []byte("a=2"), os.ModePerm))
+	assert.NoError(t, os.Rename(temporary, filepath.Join(current, "settings", "settings.ini")))
+	content, err = os.ReadFile(filepath.Join(dataDir, "settings", "settings.ini"))
+	assert.NoError(t, err)
+	assert.Eq(t, "a=2", string(content))
+
+	//Removing a version keeps data
+	assert.NoError(t, os.RemoveAll(current))
+	assert.True(t, fileExists(filepath.Join(dataDir, "data", "config.txt")))
+
+	//Files cannot be persisted
+	assert.NoError(t, os.WriteFile(filepath.Join(previous, "app.ini"), []byte("a=1"), os.ModePerm))
+	definition.Persist = []string{"app.ini"}
+	assert.ErrSubMsg(t, persistData(log.Default(), newTransaction(log.Default(), nil), definition, previous, current), "only folders")
+}
+
+func Test_persistDataRollback(t *testing.T) {
+	previousAppPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = previousAppPath }()
+
+	previous := filepath.Join(configuration.AppPath, "demo-1.0")
+	current := filepath.Join(configuration.AppPath, "demo-2.0")
+	assert.NoError(t, os.MkdirAll(filepath.Join(previous, "data"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(filepath.Join(current, "data"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(current, "data", "default.txt"), []byte("archive"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(filepath.Join(current, "plugins"), os.ModePerm))
+	definition := data.AppDefinition{ApplicationName: "demo", Persist: []string{"data", "plugins", "cache"}}
+
+	//Undone in process
+	tx := newTransaction(log.Default(), nil)
+	assert.NoError(t, persistData(log.Default(), tx, definition, previous, current))
+	tx.rollback()
+	checkUnpersisted := func() {
+		assert.False(t, helper.IsSymlink(filepath.Join(current, "data")))
+		assert.True(t, fileExists(filepath.Join(current, "data", "default.txt")))
+		assert.True(t, fileExists(filepath.Join(current, "plugins")))
+		assert.False(t, helper.IsSymlink(filepath.Join(current, "plugins")))
+		assert.False(t, fileExists(filepath.Join(current, "cache")))
+		assert.False(t, fileExists(filepath.Join(current, "data"+previousSuffix)))
+		entries, _ := os.ReadDir(dataDirectory("demo"))
+		assert.Len(t, entries, 0)
+	}
+	checkUnpersisted()
+
+	//Undone by recover after a crash
+	journal, err := state.StartJournal(configuration.AppPath, "use", "demo", "demo-2.0")
+	assert.NoError(t, err)
+	assert.NoError(t, persistData(log.Default(), newTransaction(log.Default(), journal), definition, previous, current))
+	err, _, exitCode := Recover(false)
+	assert.NoError(t, err)
+	assert.Eq(t, EXIT_OK, exitCode)
+	checkUnpersisted()
+}
+
+func TestUsePersistRollback(t *testing.T) {
+	previousAppPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = previousAppPath }()
+
+	current := filepath.Join(configuration.AppPath, "demo-2.0")
+	assert.NoError(t, os.MkdirAll(filepath.Join(configuration.AppPath, "demo-1.0"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(filepath.Join(current, "data"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(current, "data", "default.txt"), []byte("archive"), os.ModePerm))
+
+	//Symlink cannot be created (a folder is there)
+	assert.NoError(t, os.MkdirAll(filepath.Join(configuration.AppPath, "demo", "blocking"), os.ModePerm))
+
+	currentVersion, _ := version.FromString("1.0")
+	targetVersion, _ := version.FromString("2.0")
+	appState := state.AppState{
+		Definition:     &data.AppDefinition{ApplicationName: "demo", Symlink: "demo", Version: "2.0", DownloadUrl: "https://example.org/demo-{{VERSION}}.zip", Persist: []string{"data"}},
+		CurrentVersion: currentVersion,
+	}
+	err, _, exitCode := Use(context.Background(), &appState, targetVersion, "", false)
+	assert.Err(t, err)
+	assert.Eq(t, EXIT_SYMLINK_ERROR, exitCode)
+	assert.False(t, helper.IsSymlink(filepath.Join(current, "data")))
+	assert.True(t, fileExists(filepath.Join(current, "data", "default.txt")))
+	assert.False(t, fileExists(dataDirectory("demo")))
+	journals, err := state.UnfinishedJournals(configuration.AppPath)
+	assert.NoError(t, err)
+	assert.Len(t, journals, 0)
+}
+
+func TestUsePersistFailure(t *testing.T) {
+	previousAppPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = previousAppPath }()
+
+	current := filepath.Join(configuration.AppPath, "demo-2.0")
+	assert.NoError(t, os.MkdirAll(filepath.Join(configuration.AppPath, "demo-1.0"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(filepath.Join(current, "data"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(current, "data", "default.txt"), []byte("archive"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(current, "app.ini"), []byte("a=1"), os.ModePerm))
+
+	currentVersion, _ := version.FromString("1.0")
+	targetVersion, _ := version.FromString("2.0")
+	appState := state.AppState{
+		Definition:     &data.AppDefinition{ApplicationName: "demo", Symlink: "demo", Version: "2.0", DownloadUrl: "https://example.org/demo-{{VERSION}}.zip", Persist: []string{"data", "app.ini"}},
+		CurrentVersion: currentVersion,
+	}
+	err, _, exitCode := Use(context.Background(), &appState, targetVersion, "", false)
+	assert.ErrSubMsg(t, err, "only folders")
+	assert.Eq(t, EXIT_SYMLINK_ERROR, exitCode)
+	assert.False(t, helper.IsSymlink(filepath.Join(current, "data")))
+	assert.True(t, fileExists(filepath.Join(current, "data", "default.txt")))
+	assert.False(t, fileExists(filepath.Join(current, "data"+previousSuffix)))
+	assert.False(t, fileExists(filepath.Join(configuration.AppPath, "demo")))
+}
+
+func Test_handleRestoreAndCustomFilesRollback(t *testing.T) {
+	previousAppPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = previousAppPath }()
+
+	targetVersion, _ := version.FromString("2.0")
+	appState := state.AppState{
+		Definition:     &data.AppDefinition{ApplicationName: "demo", Symlink: "demo", Persist: []string{"data"}},
+		CurrentVersion: targetVersion,
+		TargetVersion:  targetVersion,
+	}
+
+	//Refresh of current version: live folder is put back
+	current := filepath.Join(configuration.AppPath, "demo-2.0")
+	assert.NoError(t, os.MkdirAll(filepath.Join(current, "data"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(current, "data", "default.txt"), []byte("archive"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(filepath.Join(configuration.AppPath, "demo-data", "data"), os.ModePerm))
+
+	tx := newTransaction(log.Default(), nil)
+	_, err := handleRestoreAndCustomFiles(log.Default(), tx, appState, current, current)
+	assert.NoError(t, err)
+	assert.True(t, helper.IsSymlink(filepath.Join(current, "data")))
+	assert.True(t, fileExists(filepath.Join(current, "data"+previousSuffix, "default.txt"))) //kept until commit
+	tx.rollback()
+	assert.False(t, helper.IsSymlink(filepath.Join(current, "data")))
+	assert.True(t, fileExists(filepath.Join(current, "data", "default.txt")))
+
+	//Staged version: replaced content is not kept aside
+	staging := stagingFolder("demo-2.0")
+	assert.NoError(t, os.MkdirAll(filepath.Join(staging, "data"), os.ModePerm))
+	tx = newTransaction(log.Default(), nil)
+	_, err = handleRestoreAndCustomFiles(log.Default(), tx, appState, staging, current)
+	assert.NoError(t, err)
+	assert.True(t, helper.IsSymlink(filepath.Join(staging, "data")))
+	assert.False(t, fileExists(filepath.Join(staging, "data"+previousSuffix)))
+	tx.commit()
+}
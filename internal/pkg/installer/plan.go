@@ -0,0 +1,162 @@
+package installer
+
+import (
+	"fmt"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Plan describes what InstallOrUpdate will do for an app (computed without side effect)
+type Plan struct {
+	AppState state.AppState
+
+	DownloadUrl   string
+	ArchivePath   string
+	ArchiveCached bool
+	Checksum      string
+	SignatureUrl  string
+
+	TargetFolder       string
+	TargetFolderExists bool
+
+	RestoreFiles  []string
+	RestoreSource string
+	Persist       []string
+	DataDirectory string
+	CreateFolders []string
+	CreateFiles   []string
+
+	Symlink       string
+	SymlinkTarget string //current one
+
+	Shortcut string
+}
+
+// BuildPlan computes what InstallOrUpdate would do with the same parameters
+func BuildPlan(appState state.AppState, forceExtract bool, skipDownload bool, archivesSubDir string, refresh bool) Plan {
+	definition := appState.Definition
+	plan := Plan{AppState: appState}
+
+	if !plan.HasWork(refresh) {
+		return plan
+	}
+
+	targetVersion := appState.TargetVersion
+	appNameWithVersion := fmt.Sprint(definition.ApplicationName, "-", targetVersion)
+
+	plan.TargetFolder = path.Join(configuration.AppPath, appNameWithVersion)
+	plan.TargetFolderExists = helper.FileOrDirExists(plan.TargetFolder) && !forceExtract
+	logger := appState.Logger()
+	values := renderValues(*definition, targetVersion, plan.TargetFolder)
+
+	if !plan.TargetFolderExists {
+		plan.DownloadUrl = fill(logger, definition.DownloadUrl, values)
+		if !strings.HasPrefix(plan.DownloadUrl, "manual") {
+			plan.ArchivePath = path.Join(configuration.AppPath, archivesSubDir, fmt.Sprint(appNameWithVersion, definition.DownloadExtension))
+			plan.ArchiveCached = skipDownload && helper.FileOrDirExists(plan.ArchivePath)
+			plan.Checksum = fill(logger, definition.Checksum, values)
+			if signature := archiveSignature(appState); signature.IsSet() || definition.ApplicationName == "nomad" {
+				plan.SignatureUrl = signature.SignatureUrl(plan.DownloadUrl)
+			}
+			if plan.Checksum == "" {
+				if _, _, _, _, isGithubRelease := data.GithubReleaseAsset(plan.DownloadUrl); isGithubRelease {
+					plan.Checksum = "published in github release (if any)"
+				}
+			}
+		}
+	}
+
+	if restoreFiles := notPersisted(*definition); appState.Status != state.KEEP && appState.CurrentVersionFolder != "" && len(restoreFiles) > 0 {
+		plan.RestoreFiles = restoreFiles
+		plan.RestoreSource = appState.CurrentVersionFolder
+	}
+	if len(definition.Persist) > 0 {
+		plan.Persist = definition.Persist
+		plan.DataDirectory = dataDirectory(definition.ApplicationName)
+	}
+	plan.CreateFolders = definition.CreateFolders
+	for name := range definition.CreateFiles {
+		plan.CreateFiles = append(plan.CreateFiles, fill(logger, name, values))
+	}
+	sort.Strings(plan.CreateFiles)
+
+	plan.Symlink = filepath.Join(configuration.AppPath, definition.Symlink)
+	plan.SymlinkTarget = helper.GetSymlinkTarget(plan.Symlink)
+
+	if definition.Shortcut != "" {
+		plan.Shortcut = shortcutPath(filepath.Base(fill(logger, definition.Shortcut, values)), configuration.DefaultShortcutsDir)
+	}
+
+	return plan
+}
+
+// HasWork tells if InstallOrUpdate will change something
+func (plan Plan) HasWork(refresh bool) bool {
+	return plan.AppState.Status != state.KEEP || refresh
+}
+
+// Describe returns human readable lines of the plan
+func (plan Plan) Describe() (lines []string) {
+	lines = append(lines, plan.AppState.StatusMessage())
+	if plan.TargetFolder == "" {
+		return
+	}
+
+	if plan.TargetFolderExists {
+		lines = append(lines, fmt.Sprint("  reuse existing ", plan.TargetFolder, " (use -force to extract again)"))
+	} else {
+		if plan.ArchivePath == "" {
+			lines = append(lines, fmt.Sprint("  download from manual URL (asked during install) ", plan.DownloadUrl))
+		} else if plan.ArchiveCached {
+			lines = append(lines, fmt.Sprint("  use cached archive ", plan.ArchivePath, " (use -skip=false to download again)"))
+		} else {
+			lines = append(lines, fmt.Sprint("  download ", plan.DownloadUrl, " -> ", plan.ArchivePath))
+		}
+		if plan.Checksum != "" {
+			lines = append(lines, fmt.Sprint("  verify checksum ", plan.Checksum))
+		}
+		if plan.SignatureUrl != "" {
+			lines = append(lines, fmt.Sprint("  verify signature ", plan.SignatureUrl))
+		}
+		if plan.AppState.Locked != nil {
+			lines = append(lines, fmt.Sprint("  verify sha256 ", plan.AppState.Locked.Sha256, " (", configuration.LockFileName, ")"))
+		}
+		lines = append(lines, fmt.Sprint("  extract to ", plan.TargetFolder))
+	}
+
+	if len(plan.RestoreFiles) > 0 {
+		lines = append(lines, fmt.Sprint("  restore ", strings.Join(plan.RestoreFiles, ","), " from ", plan.RestoreSource))
+	}
+	if len(plan.Persist) > 0 {
+		lines = append(lines, fmt.Sprint("  link ", strings.Join(plan.Persist, ","), " to ", plan.DataDirectory))
+	}
+	if len(plan.CreateFolders) > 0 {
+		lines = append(lines, fmt.Sprint("  create folders ", strings.Join(plan.CreateFolders, ","), " (if missing)"))
+	}
+	if len(plan.CreateFiles) > 0 {
+		mode := " (if missing)"
+		if plan.AppState.Definition.OverwriteFiles {
+			mode = " (overwrite)"
+		}
+		lines = append(lines, fmt.Sprint("  create files ", strings.Join(plan.CreateFiles, ","), mode))
+	}
+
+	absoluteTarget, _ := filepath.Abs(plan.TargetFolder)
+	if plan.SymlinkTarget == "" {
+		lines = append(lines, fmt.Sprint("  link ", plan.Symlink, " -> ", plan.TargetFolder))
+	} else if plan.SymlinkTarget != absoluteTarget {
+		lines = append(lines, fmt.Sprint("  relink ", plan.Symlink, " from ", plan.SymlinkTarget, " to ", plan.TargetFolder))
+	}
+
+	if plan.Shortcut != "" {
+		lines = append(lines, fmt.Sprint("  shortcut ", plan.Shortcut))
+	}
+
+	return
+}
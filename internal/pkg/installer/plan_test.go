@@ -0,0 +1,50 @@
+package installer
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildPlan(t *testing.T) {
+	appPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = appPath }()
+
+	target, _ := version.FromString("2.0.0")
+	appState := state.AppState{
+		Definition: &data.AppDefinition{
+			ApplicationName:   "app",
+			Symlink:           "app",
+			DownloadUrl:       "https://example.org/app-{{VERSION}}.zip",
+			DownloadExtension: ".zip",
+		},
+		TargetVersion: target,
+		Status:        state.INSTALL,
+	}
+
+	plan := BuildPlan(appState, false, true, "archives", false)
+	assert.True(t, plan.HasWork(false))
+	assert.Equal(t, "https://example.org/app-2.0.0.zip", plan.DownloadUrl)
+	assert.False(t, plan.ArchiveCached)
+	assert.False(t, plan.TargetFolderExists)
+	assert.Contains(t, plan.Describe(), "  extract to "+plan.TargetFolder)
+
+	//Cached archive and existing folder
+	assert.NoError(t, os.MkdirAll(filepath.Join(configuration.AppPath, "archives"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(configuration.AppPath, "archives", "app-2.0.0.zip"), []byte{}, os.ModePerm))
+	assert.True(t, BuildPlan(appState, false, true, "archives", false).ArchiveCached)
+	assert.NoError(t, os.Mkdir(filepath.Join(configuration.AppPath, "app-2.0.0"), os.ModePerm))
+	assert.True(t, BuildPlan(appState, false, true, "archives", false).TargetFolderExists)
+	assert.False(t, BuildPlan(appState, true, true, "archives", false).TargetFolderExists)
+
+	//Nothing to do
+	appState.Status = state.KEEP
+	assert.False(t, BuildPlan(appState, false, true, "archives", false).HasWork(false))
+	assert.Len(t, BuildPlan(appState, false, true, "archives", false).Describe(), 1)
+}
@@ -0,0 +1,220 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"github.com/jonathanMelly/nomad/pkg/bytesize"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// restoreBackupRegex matches backups made by restore(logger, ) (file-2006-01-02-15h04m05s)
+var restoreBackupRegex = regexp.MustCompile(`-\d{4}-\d{2}-\d{2}-\d{2}h\d{2}m\d{2}s$`)
+
+type pruneCandidate struct {
+	Path   string
+	Reason string
+	Size   int64
+}
+
+// Prune removes old versions, archives and restore backups according to retention rules
+func Prune(retention data.Retention, archivesSubDir string, dryRun bool, askForConfirmation bool) (err error, errorMessage string, exitCode int) {
+
+	candidates, err := buildPrunePlan(state.ScanCurrentApps(configuration.AppPath),
+		filepath.Join(configuration.AppPath, archivesSubDir), retention, time.Now())
+	if err != nil {
+		return err, "Cannot compute prune plan", EXIT_PRUNE_ERROR
+	}
+
+	if len(candidates) == 0 {
+		log.Infoln("Nothing to prune")
+		return nil, "", EXIT_OK
+	}
+
+	var total int64
+	for _, candidate := range candidates {
+		log.Infoln("-", candidate.Path, fmt.Sprint("(", bytesize.ByteSize(candidate.Size), ")"), candidate.Reason)
+		total += candidate.Size
+	}
+
+	if dryRun {
+		log.Infoln(len(candidates), "entries would be removed, freeing", bytesize.ByteSize(total))
+		return nil, "", EXIT_OK
+	}
+
+	if askForConfirmation && !userAgrees(fmt.Sprint("Remove ", len(candidates), " entries (", bytesize.ByteSize(total), ")")) {
+		return nil, "Action aborted by user", EXIT_ABORTED_BY_USER
+	}
+
+	var _errors []error
+	var freed int64
+	for _, candidate := range candidates {
+		log.Debugln("Removing", candidate.Path)
+		if err := os.RemoveAll(candidate.Path); err != nil {
+			_errors = append(_errors, err)
+		} else {
+			freed += candidate.Size
+			//Archives are not recorded (ignored)
+			if err := state.ForgetInstalls(filepath.Dir(candidate.Path), filepath.Base(candidate.Path)); err != nil {
+				log.Warnln("Cannot update install state |", err)
+			}
+		}
+	}
+	log.Infoln("Freed", bytesize.ByteSize(freed))
+
+	if err := errors.Join(_errors...); err != nil {
+		return err, "Prune not complete", EXIT_PRUNE_ERROR
+	}
+	return nil, "", EXIT_OK
+}
+
+func buildPrunePlan(installedApps state.AppStates, archivesDir string, retention data.Retention, now time.Time) ([]pruneCandidate, error) {
+	var candidates []pruneCandidate
+
+	//VERSIONS
+	apps := make([]string, 0, len(installedApps))
+	for app := range installedApps {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	for _, app := range apps {
+		appState := installedApps[app]
+		//Never touch active version
+		protected := map[string]bool{}
+		if target := helper.GetSymlinkTarget(filepath.Join(configuration.AppPath, appState.Definition.Symlink)); target != "" {
+			protected[absolute(target)] = true
+		}
+		if appState.CurrentVersionFolder != "" {
+			protected[absolute(appState.CurrentVersionFolder)] = true
+		}
+
+		versionFolders := state.FindVersionFolders(configuration.AppPath, app)
+		kept := 0
+		for i := len(versionFolders) - 1; i >= 0; i-- { /*newest first*/
+			versionFolder := versionFolders[i]
+			if protected[absolute(versionFolder.Folder)] || retention.KeepVersions <= 0 || kept < retention.KeepVersions {
+				kept++
+				candidates = append(candidates, findRestoreBackups(versionFolder.Folder, appState.Definition.RestoreFiles)...)
+			} else {
+				candidates = append(candidates, pruneCandidate{
+					Path:   versionFolder.Folder,
+					Reason: fmt.Sprint("more than ", retention.KeepVersions, " versions installed"),
+					Size:   helper.Size(versionFolder.Folder),
+				})
+			}
+		}
+	}
+
+	//ARCHIVES
+	archiveCandidates, err := findArchivesToPrune(archivesDir, retention, now)
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, archiveCandidates...)
+
+	return candidates, nil
+}
+
+func findArchivesToPrune(archivesDir string, retention data.Retention, now time.Time) ([]pruneCandidate, error) {
+	if !helper.FileOrDirExists(archivesDir) {
+		return nil, nil
+	}
+
+	var maxSize bytesize.ByteSize
+	if retention.MaxArchivesSize != "" {
+		var err error
+		if maxSize, err = bytesize.Parse(retention.MaxArchivesSize); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := os.ReadDir(archivesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []pruneCandidate
+	var remaining []fs.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		archivePath := filepath.Join(archivesDir, entry.Name())
+		if strings.HasSuffix(entry.Name(), ".bad") {
+			candidates = append(candidates, pruneCandidate{Path: archivePath, Reason: "bad archive", Size: info.Size()})
+		} else if retention.KeepArchivesDays > 0 && now.Sub(info.ModTime()) > time.Duration(retention.KeepArchivesDays)*24*time.Hour {
+			candidates = append(candidates, pruneCandidate{Path: archivePath, Reason: fmt.Sprint("older than ", retention.KeepArchivesDays, " days"), Size: info.Size()})
+		} else {
+			remaining = append(remaining, info)
+		}
+	}
+
+	//Size cap, oldest first
+	if maxSize > 0 {
+		var total int64
+		for _, info := range remaining {
+			total += info.Size()
+		}
+		sort.SliceStable(remaining, func(i, j int) bool {
+			return remaining[i].ModTime().Before(remaining[j].ModTime())
+		})
+		for _, info := range remaining {
+			if bytesize.ByteSize(total) <= maxSize {
+				break
+			}
+			candidates = append(candidates, pruneCandidate{
+				Path:   filepath.Join(archivesDir, info.Name()),
+				Reason: fmt.Sprint("archives cache above ", retention.MaxArchivesSize),
+				Size:   info.Size(),
+			})
+			total -= info.Size()
+		}
+	}
+
+	return candidates, nil
+}
+
+// findRestoreBackups lists timestamped copies left by restore(logger, ) for given restore files
+func findRestoreBackups(versionFolder string, restoreFiles []string) (candidates []pruneCandidate) {
+	for _, file := range restoreFiles {
+		restorePath := filepath.Join(versionFolder, file)
+		if helper.FileOrDirExists(restorePath) && helper.IsDirectory(restorePath) {
+			_ = filepath.WalkDir(restorePath, func(walkingPath string, entry fs.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() && restoreBackupRegex.MatchString(entry.Name()) {
+					candidates = append(candidates, pruneCandidate{Path: walkingPath, Reason: "restore backup", Size: helper.Size(walkingPath)})
+				}
+				return nil
+			})
+		} else {
+			matches, _ := filepath.Glob(fmt.Sprint(restorePath, "-*"))
+			for _, match := range matches {
+				if restoreBackupRegex.MatchString(match) {
+					candidates = append(candidates, pruneCandidate{Path: match, Reason: "restore backup", Size: helper.Size(match)})
+				}
+			}
+		}
+	}
+	return
+}
+
+func absolute(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
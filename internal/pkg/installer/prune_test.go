@@ -0,0 +1,54 @@
+package installer
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_findArchivesToPrune(t *testing.T) {
+	archivesDir := t.TempDir()
+	now := time.Now()
+	archives := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"old-1.0.zip", 10, 40 * 24 * time.Hour},
+		{"big-1.0.zip", 100, 3 * 24 * time.Hour},
+		{"small-1.0.zip", 10, 24 * time.Hour},
+		{"broken-1.0.zip-2024-01-01X10_00_00.bad", 10, time.Hour},
+	}
+	for _, archive := range archives {
+		archivePath := filepath.Join(archivesDir, archive.name)
+		assert.NoError(t, os.WriteFile(archivePath, make([]byte, archive.size), os.ModePerm))
+		assert.NoError(t, os.Chtimes(archivePath, now.Add(-archive.age), now.Add(-archive.age)))
+	}
+
+	candidates, err := findArchivesToPrune(archivesDir, data.Retention{KeepArchivesDays: 30, MaxArchivesSize: "50"}, now)
+	assert.NoError(t, err)
+
+	var pruned []string
+	for _, candidate := range candidates {
+		pruned = append(pruned, filepath.Base(candidate.Path))
+	}
+	assert.Len(t, pruned, 3)
+	assert.Contains(t, pruned, "old-1.0.zip")
+	assert.Contains(t, pruned, "big-1.0.zip")
+	assert.Contains(t, pruned, "broken-1.0.zip-2024-01-01X10_00_00.bad")
+}
+
+func Test_findRestoreBackups(t *testing.T) {
+	versionFolder := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(versionFolder, "data"), os.ModePerm))
+	for _, name := range []string{"app.conf", "app.conf-2024-03-07-10h05m00s", "data/settings.json", "data/settings.json-2024-03-07-10h05m00s", "other-2024-03-07-10h05m00s"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(versionFolder, name), []byte("x"), os.ModePerm))
+	}
+
+	candidates := findRestoreBackups(versionFolder, []string{"app.conf", "data"})
+
+	assert.Len(t, candidates, 2)
+}
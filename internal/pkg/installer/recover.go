@@ -0,0 +1,184 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	junction "github.com/nyaosorg/go-windows-junction"
+	"github.com/udhos/equalfile"
+	"os"
+)
+
+// Recover finishes or undoes operations interrupted by a crash (journals left in apps root)
+// An operation is finished if its new version was completely in place when it stopped, undone otherwise
+func Recover(dryRun bool) (err error, errorMessage string, exitCode int) {
+	journals, err := state.UnfinishedJournals(configuration.AppPath)
+	var errs []error
+	if err != nil {
+		log.Errorln(err)
+		errs = append(errs, err)
+	}
+	if len(journals) == 0 && err == nil {
+		log.Infoln("Nothing to recover")
+		return nil, "", EXIT_OK
+	}
+
+	for _, journal := range journals {
+		logger := helper.NewAppLogger(journal.App, log.Writer())
+		forward := canRollForward(journal)
+		action := "undo"
+		if forward {
+			action = "finish"
+		}
+		if dryRun {
+			logger.Infoln("would", action, journal)
+			continue
+		}
+
+		logger.Infoln("Trying to", action, journal)
+		if forward {
+			err = rollForward(logger, journal)
+		} else {
+			err = rollBack(logger, journal)
+		}
+		if err != nil {
+			logger.Errorln("Cannot", action, journal, "|", err)
+			errs = append(errs, err)
+		} else if err := journal.Close(); err != nil {
+			errs = append(errs, err)
+		} else {
+			logger.Infoln("Recovered", journal)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...), "Recover not complete", EXIT_RECOVER_ERROR
+	}
+	return nil, "", EXIT_OK
+}
+
+// canRollForward tells if an operation went far enough to be finished
+// (new version folder in place and symlink step begun)
+func canRollForward(journal *state.Journal) bool {
+	if journal.Step(stepSymlink) == nil {
+		return false
+	}
+	promote := journal.Step(stepPromote)
+	if promote == nil {
+		//Nothing extracted (use, refresh)
+		return journal.Step(stepStage) == nil
+	}
+	//Staging renamed but not yet marked done
+	return promote.Done || (!helper.FileOrDirExists(promote.Paths["staging"]) && helper.FileOrDirExists(promote.Paths["target"]))
+}
+
+// rollForward redoes the last steps (all are idempotent) and removes what was left aside
+func rollForward(logger *log.Logger, journal *state.Journal) error {
+	var errs []error
+	if step := journal.Step(stepSymlink); step != nil {
+		errs = append(errs, relink(logger, step.Paths["symlink"], step.Paths["target"]))
+	}
+	if step := journal.Step(stepBinary); step != nil {
+		errs = append(errs, finishBinary(logger, step.Paths["binary"], step.Paths["newBinary"], step.Paths["oldBinary"]))
+	}
+	if step := journal.Step(stepPromote); step != nil && step.Paths["previous"] != "" {
+		errs = append(errs, os.RemoveAll(step.Paths["previous"]))
+	}
+	if step := journal.Step(stepStage); step != nil {
+		errs = append(errs, os.RemoveAll(step.Paths["staging"]))
+	}
+	for _, step := range journal.Steps {
+		if step.Name == stepPersist && step.Paths["aside"] != "" {
+			errs = append(errs, os.RemoveAll(step.Paths["aside"]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// rollBack undoes begun steps (in reverse order), checking what was really applied
+func rollBack(logger *log.Logger, journal *state.Journal) error {
+	var errs []error
+	for index := len(journal.Steps) - 1; index >= 0; index-- {
+		paths := journal.Steps[index].Paths
+		switch journal.Steps[index].Name {
+		case stepBinary:
+			if helper.FileOrDirExists(paths["oldBinary"]) {
+				logger.Infoln("Restoring", paths["binary"], "from", paths["oldBinary"])
+				if err := os.Remove(paths["binary"]); err != nil && !errors.Is(err, os.ErrNotExist) {
+					errs = append(errs, err)
+					continue
+				}
+				errs = append(errs, os.Rename(paths["oldBinary"], paths["binary"]))
+			}
+		case stepSymlink:
+			errs = append(errs, relink(logger, paths["symlink"], paths["previousTarget"]))
+		case stepPromote:
+			errs = append(errs, unpromote(logger, paths["staging"], paths["target"], paths["previous"]))
+		case stepPersist:
+			errs = append(errs, unpersist(logger, paths["link"], paths["data"], paths["aside"]))
+		case stepData:
+			logger.Infoln("Removing", paths["data"])
+			errs = append(errs, os.RemoveAll(paths["data"]))
+		case stepStage:
+			errs = append(errs, os.RemoveAll(paths["staging"]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// unpromote puts back the folder replaced by promote (or removes the promoted one if it was new)
+func unpromote(logger *log.Logger, staging string, target string, previous string) error {
+	if previous != "" {
+		if !helper.FileOrDirExists(previous) {
+			//Not moved away
+			return nil
+		}
+		logger.Infoln("Restoring", target, "from", previous)
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+		return os.Rename(previous, target)
+	} else if !helper.FileOrDirExists(staging) && helper.FileOrDirExists(target) {
+		logger.Infoln("Removing", target)
+		return os.RemoveAll(target)
+	}
+	return nil
+}
+
+// relink points symlink to target (symlink removed if target is empty)
+func relink(logger *log.Logger, symlink string, target string) error {
+	if helper.GetSymlinkTarget(symlink) == target && target != "" {
+		return nil
+	}
+	if helper.IsSymlink(symlink) {
+		if err := os.Remove(symlink); err != nil {
+			return err
+		}
+	} else if helper.FileOrDirExists(symlink) {
+		return errors.New(fmt.Sprint(symlink, " is not a symlink, please check it manually"))
+	}
+	if target == "" {
+		return nil
+	}
+	logger.Infoln("Linking", symlink, "->", target)
+	return junction.Create(target, symlink)
+}
+
+// finishBinary completes a nomad binary replacement (see replaceBinary)
+func finishBinary(logger *log.Logger, binary string, newBinary string, oldBinary string) error {
+	if sameContent, err := equalfile.New(nil, equalfile.Options{}).CompareFile(binary, newBinary); err == nil && sameContent {
+		return nil
+	}
+	if !helper.FileOrDirExists(oldBinary) {
+		//Not renamed yet
+		return replaceBinary(logger, binary, newBinary, oldBinary)
+	}
+	logger.Infoln("Copying", newBinary, "to", binary)
+	if err := os.Remove(binary); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return copyBinary(newBinary, binary)
+}
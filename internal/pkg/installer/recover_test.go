@@ -0,0 +1,107 @@
+package installer
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	junction "github.com/nyaosorg/go-windows-junction"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// crashedInstall leaves app-1.0 (linked) and app-2.0 promoted over a previous app-2.0 (like a crash after promote)
+func crashedInstall(t *testing.T) (journal *state.Journal, symlink string, oldTarget string, target string, previous string) {
+	symlink = filepath.Join(configuration.AppPath, "app")
+	oldTarget = filepath.Join(configuration.AppPath, "app-1.0")
+	target = filepath.Join(configuration.AppPath, "app-2.0")
+	previous = target + previousSuffix
+	staging := stagingFolder("app-2.0")
+
+	assert.NoError(t, os.MkdirAll(oldTarget, os.ModePerm))
+	assert.NoError(t, junction.Create(oldTarget, symlink))
+	assert.NoError(t, os.MkdirAll(previous, os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(previous, "old.txt"), []byte("old"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(target, os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(target, "new.txt"), []byte("new"), os.ModePerm))
+
+	journal, err := state.StartJournal(configuration.AppPath, "install", "app", "app-2.0")
+	assert.NoError(t, err)
+	assert.NoError(t, journal.Begin(stepStage, map[string]string{"staging": staging}))
+	assert.NoError(t, journal.Done())
+	assert.NoError(t, journal.Begin(stepPromote, map[string]string{"staging": staging, "target": target, "previous": previous}))
+	return
+}
+
+func TestRecoverRollForward(t *testing.T) {
+	appPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = appPath }()
+
+	//Crashed while relinking (promote done but not yet marked)
+	journal, symlink, _, target, previous := crashedInstall(t)
+	assert.NoError(t, journal.Begin(stepSymlink, map[string]string{"symlink": symlink, "target": target, "previousTarget": helper.GetSymlinkTarget(symlink)}))
+
+	//Dry run changes nothing
+	err, _, exitCode := Recover(true)
+	assert.NoError(t, err)
+	assert.Eq(t, EXIT_OK, exitCode)
+	assert.True(t, fileExists(previous))
+
+	err, _, exitCode = Recover(false)
+	assert.NoError(t, err)
+	assert.Eq(t, EXIT_OK, exitCode)
+	assert.Eq(t, target, helper.GetSymlinkTarget(symlink))
+	assert.True(t, fileExists(filepath.Join(target, "new.txt")))
+	assert.False(t, fileExists(previous))
+
+	journals, err := state.UnfinishedJournals(configuration.AppPath)
+	assert.NoError(t, err)
+	assert.Len(t, journals, 0)
+}
+
+func TestRecoverRollBack(t *testing.T) {
+	appPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = appPath }()
+
+	//Crashed before relinking
+	_, symlink, oldTarget, target, previous := crashedInstall(t)
+
+	err, _, exitCode := Recover(false)
+	assert.NoError(t, err)
+	assert.Eq(t, EXIT_OK, exitCode)
+	assert.Eq(t, oldTarget, helper.GetSymlinkTarget(symlink))
+	assert.True(t, fileExists(filepath.Join(target, "old.txt")))
+	assert.False(t, fileExists(filepath.Join(target, "new.txt")))
+	assert.False(t, fileExists(previous))
+
+	journals, err := state.UnfinishedJournals(configuration.AppPath)
+	assert.NoError(t, err)
+	assert.Len(t, journals, 0)
+}
+
+func TestRecoverBinary(t *testing.T) {
+	appPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = appPath }()
+
+	//Crashed between renaming the running binary and copying the new one
+	binary := filepath.Join(configuration.AppPath, "nomad")
+	oldBinary := binary + ".old"
+	newBinary := filepath.Join(configuration.AppPath, "nomad-2.0", "nomad")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(newBinary), os.ModePerm))
+	assert.NoError(t, os.WriteFile(newBinary, []byte("new"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(oldBinary, []byte("old"), os.ModePerm))
+
+	journal, err := state.StartJournal(configuration.AppPath, "install", "nomad", "nomad-2.0")
+	assert.NoError(t, err)
+	assert.NoError(t, journal.Begin(stepBinary, map[string]string{"binary": binary, "oldBinary": oldBinary, "newBinary": newBinary}))
+
+	err, _, _ = Recover(false)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(binary)
+	assert.NoError(t, err)
+	assert.Eq(t, "old", string(content))
+}
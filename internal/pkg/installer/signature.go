@@ -0,0 +1,116 @@
+package installer
+
+import (
+	"aead.dev/minisign"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"io"
+	"os"
+	"strings"
+)
+
+var errBadSignature = errors.New("bad signature")
+
+// archiveSignature returns the signature rules of an app
+// nomad archives must always be signed by the key embedded at build time
+func archiveSignature(appState state.AppState) data.Signature {
+	if appState.Definition.ApplicationName == "nomad" {
+		return data.Signature{Type: data.SIGNATURE_MINISIGN, PublicKey: configuration.NomadPublicKey}
+	}
+	signature := appState.Definition.Signature
+	signature.Url = fill(appState.Logger(), signature.Url, renderValues(*appState.Definition, appState.TargetVersion, ""))
+	return signature
+}
+
+// verifySignature downloads detached signature and checks archive with trusted public key
+// A bad signature is reported with errBadSignature, other errors are resolution issues (network, bad key...)
+func verifySignature(ctx context.Context, logger *log.Logger, archivePath string, signature data.Signature, downloadURL string, ignoreBadCert bool) error {
+	if !signature.IsSet() {
+		return errors.New("missing trusted public key (for nomad, it must be embedded at build time)")
+	}
+
+	signatureURL := signature.SignatureUrl(downloadURL)
+	logger.Debugln("Getting signature from", signatureURL)
+	signatureContent, err := helper.DownloadText(ctx, signatureURL, ignoreBadCert)
+	if err != nil {
+		return fmt.Errorf("cannot get signature %s | %w", signatureURL, err)
+	}
+
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer func(archive *os.File) {
+		err := archive.Close()
+		if err != nil {
+			logger.Errorln("Cannot close", archivePath, "|", err)
+		}
+	}(archive)
+
+	if signature.Type == data.SIGNATURE_OPENPGP {
+		err = verifyOpenPGP(archive, signature.PublicKey, signatureContent)
+	} else {
+		err = verifyMinisign(archive, signature.PublicKey, signatureContent)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Debugln("Archive", signature.Type, "signature verified")
+	return nil
+}
+
+func verifyMinisign(archive io.Reader, publicKeyText string, signatureText string) error {
+	var publicKey minisign.PublicKey
+	if err := publicKey.UnmarshalText([]byte(strings.TrimSpace(publicKeyText))); err != nil {
+		return err
+	}
+	var signature minisign.Signature
+	if err := signature.UnmarshalText([]byte(signatureText)); err != nil {
+		return err
+	}
+
+	var valid bool
+	if signature.Algorithm == minisign.HashEdDSA {
+		reader := minisign.NewReader(archive)
+		if _, err := io.Copy(io.Discard, reader); err != nil {
+			return err
+		}
+		valid = reader.Verify(publicKey, []byte(signatureText))
+	} else /*legacy signature of full content*/ {
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			return err
+		}
+		valid = minisign.Verify(publicKey, content, []byte(signatureText))
+	}
+
+	if !valid {
+		return fmt.Errorf("%w (minisign key %X)", errBadSignature, publicKey.ID())
+	}
+	return nil
+}
+
+func verifyOpenPGP(archive io.Reader, publicKeyText string, signatureText string) error {
+	keyRing, err := openpgp.ReadArmoredKeyRing(strings.NewReader(publicKeyText))
+	if err != nil {
+		return fmt.Errorf("invalid OpenPGP public key | %w", err)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(signatureText), "-----BEGIN") {
+		_, err = openpgp.CheckArmoredDetachedSignature(keyRing, archive, strings.NewReader(signatureText), nil)
+	} else {
+		_, err = openpgp.CheckDetachedSignature(keyRing, archive, bytes.NewReader([]byte(signatureText)), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("%w | %v", errBadSignature, err)
+	}
+	return nil
+}
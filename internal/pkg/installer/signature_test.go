@@ -0,0 +1,124 @@
+package installer
+
+import (
+	"aead.dev/minisign"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/gologme/log"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func serveText(t *testing.T, content []byte) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/signature"
+}
+
+func writeArchive(t *testing.T, content string) string {
+	archive := filepath.Join(t.TempDir(), "app-1.0.zip")
+	assert.NoError(t, os.WriteFile(archive, []byte(content), os.ModePerm))
+	return archive
+}
+
+func Test_verifySignatureMinisign(t *testing.T) {
+	publicKey, privateKey, err := minisign.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	publicKeyText, _ := publicKey.MarshalText()
+
+	reader := minisign.NewReader(bytes.NewReader([]byte("archive content")))
+	_, err = io.Copy(io.Discard, reader)
+	assert.NoError(t, err)
+	signature := data.Signature{Type: data.SIGNATURE_MINISIGN, PublicKey: string(publicKeyText), Url: serveText(t, reader.Sign(privateKey))}
+
+	assert.NoError(t, verifySignature(context.Background(), log.Default(), writeArchive(t, "archive content"), signature, "", false))
+	assert.True(t, errors.Is(verifySignature(context.Background(), log.Default(), writeArchive(t, "tampered content"), signature, "", false), errBadSignature))
+
+	//legacy (not prehashed) signature
+	signature.Url = serveText(t, minisign.Sign(privateKey, []byte("archive content")))
+	assert.NoError(t, verifySignature(context.Background(), log.Default(), writeArchive(t, "archive content"), signature, "", false))
+
+	//other key
+	otherKey, _, _ := minisign.GenerateKey(rand.Reader)
+	signature.PublicKey = otherKey.String()
+	assert.True(t, errors.Is(verifySignature(context.Background(), log.Default(), writeArchive(t, "archive content"), signature, "", false), errBadSignature))
+}
+
+func Test_verifySignatureOpenPGP(t *testing.T) {
+	entity, err := openpgp.NewEntity("nomad", "test", "nomad@example.org", nil)
+	assert.NoError(t, err)
+
+	publicKey := bytes.Buffer{}
+	armored, _ := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	assert.NoError(t, entity.Serialize(armored))
+	assert.NoError(t, armored.Close())
+
+	detached := bytes.Buffer{}
+	assert.NoError(t, openpgp.ArmoredDetachSign(&detached, entity, bytes.NewReader([]byte("archive content")), nil))
+	signature := data.Signature{Type: data.SIGNATURE_OPENPGP, PublicKey: publicKey.String(), Url: serveText(t, detached.Bytes())}
+
+	assert.NoError(t, verifySignature(context.Background(), log.Default(), writeArchive(t, "archive content"), signature, "", false))
+	assert.True(t, errors.Is(verifySignature(context.Background(), log.Default(), writeArchive(t, "tampered content"), signature, "", false), errBadSignature))
+}
+
+func TestUseRefusesUnsignedNomad(t *testing.T) {
+	appPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = appPath }()
+
+	//Another binary, installed without signature check (no record)
+	binaryName := filepath.Base(os.Args[0])
+	if runtime.GOOS == "windows" && !strings.HasSuffix(binaryName, ".exe") {
+		binaryName += ".exe"
+	}
+	target := filepath.Join(configuration.AppPath, "nomad-2.0")
+	assert.NoError(t, os.MkdirAll(target, os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(target, binaryName), []byte("unsigned"), os.ModePerm))
+
+	currentVersion, _ := version.FromString("1.0")
+	targetVersion, _ := version.FromString("2.0")
+	appState := state.AppState{
+		Definition:     &data.AppDefinition{ApplicationName: "nomad", Symlink: "nomad", Version: "2.0", DownloadUrl: "https://example.org/nomad-{{VERSION}}.zip"},
+		CurrentVersion: currentVersion,
+	}
+	err, message, exitCode := Use(context.Background(), &appState, targetVersion, "", false)
+	assert.ErrSubMsg(t, err, "signature of")
+	assert.Eq(t, "Symlink issue", message)
+	assert.Eq(t, EXIT_SYMLINK_ERROR, exitCode)
+	assert.False(t, fileExists(fmt.Sprint(os.Args[0], ".", currentVersion)))
+}
+
+func TestInstallNomadWithoutKey(t *testing.T) {
+	appPath, publicKey := configuration.AppPath, configuration.NomadPublicKey
+	configuration.AppPath, configuration.NomadPublicKey = t.TempDir(), ""
+	defer func() { configuration.AppPath, configuration.NomadPublicKey = appPath, publicKey }()
+
+	targetVersion, _ := version.FromString("2.0")
+	appState := state.AppState{
+		Definition:    &data.AppDefinition{ApplicationName: "nomad", Symlink: "nomad", Version: "2.0", DownloadUrl: "https://example.org/nomad-{{VERSION}}.zip"},
+		TargetVersion: targetVersion,
+		Status:        state.UPGRADE,
+	}
+	err, _, exitCode := InstallOrUpdate(context.Background(), &appState, false, false, "", "archives", false)
+	assert.ErrSubMsg(t, err, "no trusted key")
+	assert.Eq(t, EXIT_INSTALL_UPDATE_ERROR, exitCode)
+	assert.False(t, fileExists(filepath.Join(configuration.AppPath, "archives"))) //nothing downloaded
+}
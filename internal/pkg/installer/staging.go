@@ -0,0 +1,173 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"os"
+	"path/filepath"
+)
+
+// previousSuffix names the former content of a version folder replaced with -force (removed once install succeeded)
+const previousSuffix = ".previous"
+
+// Steps of an operation, recorded in its journal before being applied (see Recover)
+const (
+	stepStage   = "stage"
+	stepData    = "data"
+	stepPersist = "persist"
+	stepPromote = "promote"
+	stepSymlink = "symlink"
+	stepBinary  = "binary"
+)
+
+// transaction undoes applied install steps (in reverse order) when a later one fails
+// Steps are journaled so that they can be finished or undone after a crash
+type transaction struct {
+	logger   *log.Logger
+	journal  *state.Journal //nil if not journaled
+	undos    []undoStep
+	cleanups []undoStep //content kept aside for undos, removed once committed
+}
+
+type undoStep struct {
+	description string
+	undo        func() error
+}
+
+func newTransaction(logger *log.Logger, journal *state.Journal) *transaction {
+	return &transaction{logger: logger, journal: journal}
+}
+
+// begin journals the intent of a step, which must not be applied if this fails
+func (tx *transaction) begin(step string, paths map[string]string) error {
+	if tx.journal == nil {
+		return nil
+	}
+	if err := tx.journal.Begin(step, paths); err != nil {
+		return errors.New(fmt.Sprint("Cannot write journal ", tx.journal.Path(), " | ", err))
+	}
+	return nil
+}
+
+// applied marks the last begun step as done
+func (tx *transaction) applied() {
+	if tx.journal == nil {
+		return
+	}
+	if err := tx.journal.Done(); err != nil {
+		tx.logger.Warnln("Cannot write journal", tx.journal.Path(), "|", err)
+	}
+}
+
+// onRollback registers how to undo a step that has just been applied
+func (tx *transaction) onRollback(description string, undo func() error) {
+	tx.undos = append(tx.undos, undoStep{description, undo})
+}
+
+// onCommit registers how to remove what a step kept aside (to be able to undo it)
+func (tx *transaction) onCommit(description string, cleanup func() error) {
+	tx.cleanups = append(tx.cleanups, undoStep{description, cleanup})
+}
+
+// commit ends the operation (nothing to undo or recover anymore)
+func (tx *transaction) commit() {
+	tx.undos = nil
+	tx.closeJournal()
+	for _, step := range tx.cleanups {
+		if err := step.undo(); err != nil {
+			tx.logger.Warnln("Cannot", step.description, "|", err)
+		}
+	}
+	tx.cleanups = nil
+}
+
+// rollback undoes all registered steps, going on after a failed one
+// The journal is kept if something could not be undone (see Recover)
+func (tx *transaction) rollback() {
+	complete := true
+	for index := len(tx.undos) - 1; index >= 0; index-- {
+		step := tx.undos[index]
+		tx.logger.Infoln("Rolling back:", step.description)
+		if err := step.undo(); err != nil {
+			tx.logger.Errorln("Cannot roll back", step.description, "|", err)
+			complete = false
+		}
+	}
+	tx.undos = nil
+	tx.cleanups = nil
+	if complete {
+		tx.closeJournal()
+	} else if tx.journal != nil {
+		tx.logger.Warnln("Please run recover to finish rollback (", tx.journal.Path(), ")")
+		tx.journal = nil
+	}
+}
+
+func (tx *transaction) closeJournal() {
+	if tx.journal == nil {
+		return
+	}
+	if err := tx.journal.Close(); err != nil {
+		tx.logger.Warnln("Cannot remove journal", tx.journal.Path(), "|", err)
+	}
+	tx.journal = nil
+}
+
+// stagingFolder is where a version is extracted and prepared before being promoted
+func stagingFolder(appNameWithVersion string) string {
+	return filepath.Join(configuration.AppPath, configuration.StagingDir, appNameWithVersion)
+}
+
+// prepareStaging removes leftovers of an interrupted install
+func prepareStaging(logger *log.Logger, staging string) error {
+	if helper.FileOrDirExists(staging) {
+		logger.Debugln("Removing leftover", staging)
+		if err := os.RemoveAll(staging); err != nil {
+			return errors.New(fmt.Sprint("Cannot remove leftover ", staging, " | ", err))
+		}
+	}
+	return os.MkdirAll(filepath.Dir(staging), os.ModePerm)
+}
+
+// promote replaces target with the staging folder in one rename
+// An existing target (-force) is kept aside (returned) until the install succeeds
+func promote(logger *log.Logger, tx *transaction, staging string, target string) (previous string, err error) {
+	if helper.FileOrDirExists(target) {
+		previous = fmt.Sprint(staging, previousSuffix)
+	}
+	if err := tx.begin(stepPromote, map[string]string{"staging": staging, "target": target, "previous": previous}); err != nil {
+		return "", err
+	}
+
+	if previous != "" {
+		if err := os.RemoveAll(previous); err != nil {
+			return "", err
+		}
+		logger.Debugln("Moving", target, "to", previous)
+		if err := os.Rename(target, previous); err != nil {
+			return "", errors.New(fmt.Sprint("Cannot move away ", target, " (in use ?) | ", err))
+		}
+		tx.onRollback(fmt.Sprint("restore ", target), func() error {
+			return os.Rename(previous, target)
+		})
+	}
+
+	logger.Debugln("Moving", staging, "to", target)
+	if err := os.Rename(staging, target); err != nil {
+		return previous, errors.New(fmt.Sprint("Cannot move ", staging, " to ", target, " | ", err))
+	}
+	tx.onRollback(fmt.Sprint("remove ", target), removeAll(target))
+	tx.applied()
+	return previous, nil
+}
+
+// removeAll is an undo step removing what a step created
+func removeAll(path string) func() error {
+	return func() error {
+		return os.RemoveAll(path)
+	}
+}
@@ -0,0 +1,120 @@
+package installer
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"github.com/gologme/log"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	var undone []string
+	tx := newTransaction(log.Default(), nil)
+	tx.onRollback("first", func() error { undone = append(undone, "first"); return nil })
+	tx.onRollback("second", func() error { undone = append(undone, "second"); return os.ErrPermission })
+	tx.onRollback("third", func() error { undone = append(undone, "third"); return nil })
+
+	tx.rollback()
+	assert.Eq(t, []string{"third", "second", "first"}, undone) //goes on after a failure
+
+	tx.rollback()
+	assert.Len(t, undone, 3)
+}
+
+func TestPromote(t *testing.T) {
+	directory := t.TempDir()
+	staging := filepath.Join(directory, ".staging", "app-1.0")
+	target := filepath.Join(directory, "app-1.0")
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(staging, "leftover"), os.ModePerm))
+	assert.NoError(t, prepareStaging(log.Default(), staging))
+	assert.False(t, fileExists(staging))
+
+	assert.NoError(t, os.MkdirAll(staging, os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(staging, "new.txt"), []byte("new"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(target, os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(target, "old.txt"), []byte("old"), os.ModePerm))
+
+	tx := newTransaction(log.Default(), nil)
+	previous, err := promote(log.Default(), tx, staging, target)
+	assert.NoError(t, err)
+	assert.True(t, fileExists(filepath.Join(target, "new.txt")))
+	assert.True(t, fileExists(filepath.Join(previous, "old.txt")))
+
+	tx.rollback()
+	assert.True(t, fileExists(filepath.Join(target, "old.txt")))
+	assert.False(t, fileExists(filepath.Join(target, "new.txt")))
+	assert.False(t, fileExists(previous))
+}
+
+func TestInstallOrUpdateRollback(t *testing.T) {
+	appPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = appPath }()
+
+	//Cached archive (no download)
+	content := bytes.Buffer{}
+	writer := zip.NewWriter(&content)
+	file, _ := writer.Create("app/new.txt")
+	_, _ = file.Write([]byte("new"))
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, os.MkdirAll(filepath.Join(configuration.AppPath, "archives"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(configuration.AppPath, "archives", "app-2.0.0.zip"), content.Bytes(), os.ModePerm))
+
+	//Forced reinstall over an existing folder
+	target := filepath.Join(configuration.AppPath, "app-2.0.0")
+	assert.NoError(t, os.MkdirAll(target, os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(target, "old.txt"), []byte("old"), os.ModePerm))
+
+	//Symlink cannot be created (a folder is there)
+	symlink := filepath.Join(configuration.AppPath, "app")
+	assert.NoError(t, os.MkdirAll(filepath.Join(symlink, "blocking"), os.ModePerm))
+
+	targetVersion, _ := version.FromString("2.0.0")
+	appState := state.AppState{
+		Definition:    &data.AppDefinition{ApplicationName: "app", Symlink: "app", Version: "2.0.0", DownloadUrl: "https://example.org/app-{{VERSION}}.zip"},
+		TargetVersion: targetVersion,
+		Status:        state.INSTALL,
+	}
+	appState.Definition.ComputeDownloadExtension()
+
+	err, _, exitCode := InstallOrUpdate(context.Background(), &appState, true, true, "", "archives", false)
+	assert.Err(t, err)
+	assert.Eq(t, EXIT_SYMLINK_ERROR, exitCode)
+	assert.True(t, fileExists(filepath.Join(target, "old.txt")))
+	assert.False(t, fileExists(filepath.Join(target, "new.txt")))
+	assert.False(t, fileExists(stagingFolder("app-2.0.0")))
+	assert.False(t, fileExists(stagingFolder("app-2.0.0")+previousSuffix))
+
+	//Canceled (ctrl-c) while extracting: nothing replaced, nothing left to recover
+	assert.NoError(t, os.RemoveAll(symlink))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err, _, exitCode = InstallOrUpdate(ctx, &appState, true, true, "", "archives", false)
+	assert.Err(t, err)
+	assert.Eq(t, EXIT_CANCELED, exitCode)
+	assert.True(t, fileExists(filepath.Join(target, "old.txt")))
+	assert.False(t, fileExists(symlink))
+	assert.False(t, fileExists(stagingFolder("app-2.0.0")))
+	journals, err := state.UnfinishedJournals(configuration.AppPath)
+	assert.NoError(t, err)
+	assert.Len(t, journals, 0)
+
+	err, _, exitCode = InstallOrUpdate(context.Background(), &appState, true, true, "", "archives", false)
+	assert.NoError(t, err)
+	assert.Eq(t, EXIT_OK, exitCode)
+	assert.True(t, fileExists(filepath.Join(target, "new.txt")))
+	assert.False(t, fileExists(filepath.Join(target, "old.txt")))
+	assert.False(t, fileExists(stagingFolder("app-2.0.0")+previousSuffix))
+	absoluteTarget, _ := filepath.Abs(target)
+	assert.Eq(t, absoluteTarget, helper.GetSymlinkTarget(symlink))
+}
@@ -0,0 +1,275 @@
+package installer
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// tarCompressions gives the compression of supported tar extensions
+var tarCompressions = map[string]string{
+	".tar":     "",
+	".tar.gz":  ".gz",
+	".tgz":     ".gz",
+	".tar.xz":  ".xz",
+	".txz":     ".xz",
+	".tar.bz2": ".bz2",
+	".tbz2":    ".bz2",
+	".tbz":     ".bz2",
+	".tar.zst": ".zst",
+	".tzst":    ".zst",
+}
+
+// newDecompressor returns a reader of uncompressed content (compression is an extension like .gz)
+func newDecompressor(compression string, reader io.Reader) (io.ReadCloser, error) {
+	switch compression {
+	case "":
+		return io.NopCloser(reader), nil
+	case ".gz":
+		return gzip.NewReader(reader)
+	case ".bz2":
+		return io.NopCloser(bzip2.NewReader(reader)), nil
+	case ".xz":
+		xzReader, err := xz.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xzReader), nil
+	case ".zst":
+		zstdReader, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReader.IOReadCloser(), nil
+	default:
+		return nil, errors.New(fmt.Sprint("unsupported compression ", compression))
+	}
+}
+
+// decompressFile extracts a single compressed file (a bare binary for instance)
+func decompressFile(ctx context.Context, logger *log.Logger, archivePath string, compression string, destinationPath string) error {
+	source, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	reader, err := newDecompressor(compression, contextReader{ctx, source})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(filepath.Dir(destinationPath), os.ModePerm); err != nil {
+		return err
+	}
+	//Most likely an executable
+	target, err := os.OpenFile(destinationPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	logger.Debugln("Decompressing", archivePath, "to", destinationPath)
+	if _, err := io.Copy(target, reader); err != nil {
+		_ = target.Close()
+		return err
+	}
+	return target.Close()
+}
+
+// tarEntry is an entry of a tar archive once streamed to the holding folder
+type tarEntry struct {
+	name     string //slash path in archive
+	info     fs.FileInfo
+	linkname string //symlink target
+}
+
+// extractTar streams a (compressed) tar archive once to a holding folder next to targetDirectory (same volume)
+// Entries below the deepest root folder matching allowRegExp are then moved to targetDirectory (see copyFromFS)
+func extractTar(ctx context.Context, logger *log.Logger, archivePath string, compression string, targetDirectory string, allowRegExp *regexp.Regexp) error {
+	defer extracting(logger)()
+
+	holding := fmt.Sprint(filepath.Clean(targetDirectory), ".tar")
+	if err := os.RemoveAll(holding); err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(holding); err != nil {
+			logger.Warnln("Cannot remove", holding, "|", err)
+		}
+	}()
+
+	entries, err := streamTar(ctx, logger, archivePath, compression, holding)
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.info.IsDir() {
+			files = append(files, entry.name)
+		}
+	}
+	root := deepestRootFolder(files)
+	logger.Debugln("Deepest root in archive:", root)
+
+	return moveTarEntries(ctx, logger, entries, holding, root, targetDirectory, allowRegExp)
+}
+
+// streamTar writes directories and files of the archive below holding
+// Symlinks are only listed, they are created once their final place is known
+func streamTar(ctx context.Context, logger *log.Logger, archivePath string, compression string, holding string) ([]tarEntry, error) {
+	source, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	reader, err := newDecompressor(compression, contextReader{ctx, source})
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var entries []tarEntry
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if name == "." {
+			continue
+		}
+		//Zip slip
+		if !fs.ValidPath(name) {
+			return nil, errors.Join(errInvalidArchive, errors.New(fmt.Sprint("invalid path in archive ", header.Name)))
+		}
+		destination := filepath.Join(holding, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(destination, os.ModePerm); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			if err := writeFile(ctx, logger, tarReader, destination, header.FileInfo()); err != nil {
+				return nil, err
+			}
+		case tar.TypeSymlink:
+		case tar.TypeLink:
+			target := path.Clean(strings.TrimPrefix(header.Linkname, "/"))
+			if info, err := os.Lstat(filepath.Join(holding, filepath.FromSlash(target))); !fs.ValidPath(target) || err != nil || !info.Mode().IsRegular() {
+				return nil, errors.Join(errInvalidArchive, errors.New(fmt.Sprint("hard link ", header.Name, " to unknown file ", header.Linkname)))
+			}
+			//A copy, links may not be supported by the file system
+			if err := copyFile(logger, filepath.Join(holding, filepath.FromSlash(target)), destination); err != nil {
+				return nil, err
+			}
+			header.Typeflag = tar.TypeReg
+			applyModeAndTime(logger, destination, header.FileInfo())
+		default:
+			logger.Debugln("Skipping special file", name)
+			continue
+		}
+		entries = append(entries, tarEntry{name: name, info: header.FileInfo(), linkname: header.Linkname})
+	}
+}
+
+// moveTarEntries moves streamed entries below root matching allowRegExp (and so do their folders) to targetDirectory
+func moveTarEntries(ctx context.Context, logger *log.Logger, entries []tarEntry, holding string, root string, targetDirectory string, allowRegExp *regexp.Regexp) error {
+	if err := os.MkdirAll(targetDirectory, os.ModePerm); err != nil {
+		return err
+	}
+
+	//Last entry of a name wins, like when extracting in place
+	last := map[string]int{}
+	for index, entry := range entries {
+		last[entry.name] = index
+	}
+
+	var directories []extractedDirectory //times are set once content is moved
+	for index, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		relativePathInArchive := entry.name
+		if root != "." {
+			var below bool
+			if relativePathInArchive, below = strings.CutPrefix(entry.name, fmt.Sprint(root, "/")); !below {
+				continue
+			}
+		}
+		if index != last[entry.name] {
+			continue
+		}
+		if !allowed(allowRegExp, relativePathInArchive) {
+			logger.Traceln(relativePathInArchive, "discarded because of regex", allowRegExp.String())
+			continue
+		}
+
+		destination := filepath.Join(targetDirectory, filepath.FromSlash(relativePathInArchive))
+		//Symlinks created before must not lead outside
+		if !insideFolder(targetDirectory, filepath.Dir(destination)) {
+			return errors.Join(errInvalidArchive, errors.New(fmt.Sprint("entry ", entry.name, " would be extracted through a symlink outside of ", targetDirectory)))
+		}
+
+		if entry.info.IsDir() {
+			if err := os.MkdirAll(destination, os.ModePerm); err != nil {
+				return err
+			}
+			directories = append(directories, extractedDirectory{destination, entry.info})
+		} else if entry.info.Mode()&fs.ModeSymlink != 0 {
+			if err := createSymlink(logger, entry.name, entry.linkname, targetDirectory, destination); err != nil {
+				return err
+			}
+		} else if err := moveFile(filepath.Join(holding, filepath.FromSlash(entry.name)), destination); err != nil {
+			return err
+		}
+	}
+
+	//Deepest first as setting a mode may prevent changes below
+	for index := len(directories) - 1; index >= 0; index-- {
+		applyModeAndTime(logger, directories[index].path, directories[index].info)
+	}
+	return nil
+}
+
+// allowed tells if relativePath and its folders match allowRegExp (a discarded folder discards its content)
+func allowed(allowRegExp *regexp.Regexp, relativePath string) bool {
+	for folder := path.Dir(relativePath); folder != "."; folder = path.Dir(folder) {
+		if !allowRegExp.MatchString(folder) {
+			return false
+		}
+	}
+	return allowRegExp.MatchString(relativePath)
+}
+
+// moveFile renames source to destination, never writing through an existing symlink
+func moveFile(source string, destination string) error {
+	if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+		return err
+	}
+	if existing, err := os.Lstat(destination); err == nil && existing.Mode()&fs.ModeSymlink != 0 {
+		if err := os.Remove(destination); err != nil {
+			return err
+		}
+	}
+	return os.Rename(source, destination)
+}
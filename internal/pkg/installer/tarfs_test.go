@@ -0,0 +1,147 @@
+package installer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/gologme/log"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+)
+
+// buildTar writes app-1.0/{bin/app (755), README, docs/ (implicit), link -> bin/app, hard -> README}
+func buildTar(t *testing.T, compression string) []byte {
+	content := bytes.Buffer{}
+	writer := tar.NewWriter(&content)
+	entries := []tar.Header{
+		{Name: "app-1.0/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "app-1.0/bin/app", Typeflag: tar.TypeReg, Mode: 0755, Size: 6},
+		{Name: "app-1.0/README", Typeflag: tar.TypeReg, Mode: 0644, Size: 6},
+		{Name: "app-1.0/docs/index.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 5},
+		{Name: "app-1.0/link", Typeflag: tar.TypeSymlink, Linkname: "bin/app", Mode: 0777},
+		{Name: "app-1.0/hard", Typeflag: tar.TypeLink, Linkname: "app-1.0/README", Mode: 0644},
+	}
+	bodies := map[string]string{"app-1.0/bin/app": "#!/bin", "app-1.0/README": "readme", "app-1.0/docs/index.txt": "index"}
+	for _, header := range entries {
+		header := header
+		assert.NoError(t, writer.WriteHeader(&header))
+		if body, found := bodies[header.Name]; found {
+			_, err := writer.Write([]byte(body))
+			assert.NoError(t, err)
+		}
+	}
+	assert.NoError(t, writer.Close())
+
+	compressed := bytes.Buffer{}
+	var compressor io.WriteCloser
+	var err error
+	switch compression {
+	case ".gz":
+		compressor = gzip.NewWriter(&compressed)
+	case ".xz":
+		compressor, err = xz.NewWriter(&compressed)
+	case ".zst":
+		compressor, err = zstd.NewWriter(&compressed)
+	default:
+		return content.Bytes()
+	}
+	assert.NoError(t, err)
+	_, err = compressor.Write(content.Bytes())
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+	return compressed.Bytes()
+}
+
+func Test_extractTar(t *testing.T) {
+	for _, compression := range []string{"", ".gz", ".xz", ".zst"} {
+		t.Run("tar"+compression, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "app-1.0.tar"+compression)
+			assert.NoError(t, os.WriteFile(archive, buildTar(t, compression), os.ModePerm))
+			target := filepath.Join(t.TempDir(), "app-1.0")
+
+			assert.NoError(t, extractTar(context.Background(), log.Default(), archive, compression, target, regexp.MustCompile("^(bin|README|hard)")))
+
+			hard, err := os.ReadFile(filepath.Join(target, "hard"))
+			assert.NoError(t, err)
+			assert.Eq(t, "readme", string(hard))
+			assert.True(t, fileExists(filepath.Join(target, "bin", "app")))
+			assert.False(t, fileExists(filepath.Join(target, "docs")))
+			assert.False(t, fileExists(filepath.Join(target, "link")))
+			assert.False(t, fileExists(target+".tar")) //holding folder removed
+		})
+	}
+}
+
+func Test_extractTarArchive(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "app-1.0.tar.gz")
+	assert.NoError(t, os.WriteFile(archive, buildTar(t, ".gz"), os.ModePerm))
+	target := t.TempDir()
+
+	definition := data.AppDefinition{DownloadUrl: "https://example.org/app-1.0.tar.gz"}
+	definition.ComputeDownloadExtension()
+	_, _ = definition.IsValid()
+	assert.NoError(t, extractArchive(context.Background(), log.Default(), archive, definition, target))
+
+	content, err := os.ReadFile(filepath.Join(target, "link")) //root folder removed, symlink followed
+	assert.NoError(t, err)
+	assert.Eq(t, "#!/bin", string(content))
+	assert.True(t, fileExists(filepath.Join(target, "docs", "index.txt")))
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(target, "bin", "app"))
+		assert.NoError(t, err)
+		assert.Eq(t, os.FileMode(0755), info.Mode().Perm())
+		linkTarget, err := os.Readlink(filepath.Join(target, "link"))
+		assert.NoError(t, err)
+		assert.Eq(t, "bin/app", linkTarget)
+	}
+}
+
+func Test_extractSingleFile(t *testing.T) {
+	compressed := bytes.Buffer{}
+	writer := gzip.NewWriter(&compressed)
+	_, _ = writer.Write([]byte("binary"))
+	assert.NoError(t, writer.Close())
+	archive := filepath.Join(t.TempDir(), "tool-1.0.gz")
+	assert.NoError(t, os.WriteFile(archive, compressed.Bytes(), os.ModePerm))
+	target := t.TempDir()
+
+	definition := data.AppDefinition{DownloadUrl: "https://example.org/tool-linux-amd64.gz?raw=1"}
+	definition.ComputeDownloadExtension()
+	assert.NoError(t, extractArchive(context.Background(), log.Default(), archive, definition, target))
+
+	content, err := os.ReadFile(filepath.Join(target, "tool-linux-amd64"))
+	assert.NoError(t, err)
+	assert.Eq(t, "binary", string(content))
+}
+
+func Test_extractTarSkipsLinkEscapingRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need admin rights")
+	}
+	content := bytes.Buffer{}
+	writer := tar.NewWriter(&content)
+	assert.NoError(t, writer.WriteHeader(&tar.Header{Name: "app/inside", Typeflag: tar.TypeSymlink, Linkname: "bin", Mode: 0777}))
+	assert.NoError(t, writer.WriteHeader(&tar.Header{Name: "app/outside", Typeflag: tar.TypeSymlink, Linkname: "../other", Mode: 0777})) //inside archive, not app folder
+	assert.NoError(t, writer.WriteHeader(&tar.Header{Name: "app/bin/app", Typeflag: tar.TypeReg, Mode: 0755}))
+	assert.NoError(t, writer.Close())
+	archive := filepath.Join(t.TempDir(), "app.tar")
+	assert.NoError(t, os.WriteFile(archive, content.Bytes(), os.ModePerm))
+	target := filepath.Join(t.TempDir(), "app")
+
+	assert.NoError(t, extractTar(context.Background(), log.Default(), archive, "", target, regexp.MustCompile(".*")))
+
+	_, err := os.Lstat(filepath.Join(target, "outside"))
+	assert.True(t, os.IsNotExist(err))
+	linkTarget, err := os.Readlink(filepath.Join(target, "inside"))
+	assert.NoError(t, err)
+	assert.Eq(t, "bin", linkTarget)
+}
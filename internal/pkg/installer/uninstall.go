@@ -0,0 +1,211 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// UninstallPlan describes what Uninstall will remove
+type UninstallPlan struct {
+	AppState state.AppState
+
+	Symlink         string //empty if not found
+	VersionFolders  []state.VersionFolder
+	Shortcut        string //empty if not found
+	Archives        []string
+	BackupDirectory string //empty if no backup
+	DataDirectory   string //persisted data, never removed (empty if not found)
+}
+
+// BuildUninstallPlan gathers installed objects of an app (without side effect)
+func BuildUninstallPlan(appState state.AppState, archivesSubDir string, purgeArchives bool, backupData bool) UninstallPlan {
+	definition := appState.Definition
+	appName := definition.ApplicationName
+	plan := UninstallPlan{AppState: appState}
+
+	symlink := filepath.Join(configuration.AppPath, definition.Symlink)
+	if helper.IsSymlink(symlink) {
+		plan.Symlink = symlink
+	}
+	plan.VersionFolders = state.FindVersionFolders(configuration.AppPath, appName)
+
+	if definition.Shortcut != "" && appState.CurrentVersion != nil {
+		linkName := filepath.Base(fill(appState.Logger(), definition.Shortcut, renderValues(*definition, appState.CurrentVersion, appState.CurrentVersionFolder)))
+		candidate := shortcutPath(linkName, configuration.DefaultShortcutsDir)
+		if helper.FileOrDirExists(candidate) {
+			plan.Shortcut = candidate
+		}
+	}
+
+	if purgeArchives {
+		plan.Archives = findArchives(filepath.Join(configuration.AppPath, archivesSubDir), appName)
+	}
+
+	if dataDir := dataDirectory(appName); helper.FileOrDirExists(dataDir) {
+		plan.DataDirectory = dataDir
+	}
+
+	//Keep precious data
+	if backupData && len(definition.RestoreFiles) > 0 && appState.CurrentVersionFolder != "" && helper.FileOrDirExists(appState.CurrentVersionFolder) {
+		plan.BackupDirectory = filepath.Join(configuration.AppPath, configuration.DefaultBackupsDir,
+			fmt.Sprint(appName, "-", appState.CurrentVersion, "-", time.Now().Format("2006-01-02-15h04m05s")))
+	}
+
+	return plan
+}
+
+// HasWork tells if something is installed
+func (plan UninstallPlan) HasWork() bool {
+	return plan.Symlink != "" || len(plan.VersionFolders) > 0 || plan.Shortcut != "" || len(plan.Archives) > 0
+}
+
+// Describe returns human readable lines of the plan
+func (plan UninstallPlan) Describe() (lines []string) {
+	if !plan.HasWork() {
+		return []string{"nothing to uninstall (not installed)"}
+	}
+	lines = append(lines, plan.AppState.StatusMessage())
+	if plan.BackupDirectory != "" {
+		lines = append(lines, fmt.Sprint("  keep ", strings.Join(plan.AppState.Definition.RestoreFiles, ","), " in ", plan.BackupDirectory, " (use -backup=false to skip)"))
+	}
+	if plan.DataDirectory != "" {
+		lines = append(lines, fmt.Sprint("  keep persisted data in ", plan.DataDirectory, " (remove it manually if not needed anymore)"))
+	}
+	if plan.Symlink != "" {
+		lines = append(lines, fmt.Sprint("  remove symlink ", plan.Symlink))
+	}
+	for _, versionFolder := range plan.VersionFolders {
+		lines = append(lines, fmt.Sprint("  remove folder ", versionFolder.Folder))
+	}
+	if plan.Shortcut != "" {
+		lines = append(lines, fmt.Sprint("  remove shortcut ", plan.Shortcut))
+	}
+	for _, archive := range plan.Archives {
+		lines = append(lines, fmt.Sprint("  remove archive ", archive))
+	}
+	return
+}
+
+// Uninstall removes symlink, version folders, shortcut and archives of an app as planned
+// Confirmation (if any) must be asked before
+func Uninstall(plan UninstallPlan) (err error, errorMessage string, exitCode int) {
+
+	//Aliases
+	appState := plan.AppState
+	definition := appState.Definition
+	appName := definition.ApplicationName
+
+	//Logs prefixed with app name
+	logger := appState.Logger()
+
+	//Enforce validation
+	if valid, err := definition.IsValid(); !valid {
+		return err, "invalid definition", EXIT_INVALID_DEFINITION
+	}
+
+	if appName == "nomad" {
+		return nil, "nomad cannot uninstall itself (simply delete the binary)", EXIT_UNINSTALL_ERROR
+	}
+
+	if !plan.HasWork() {
+		logger.Warnln("nothing to uninstall (not installed)")
+		return nil, "", EXIT_OK
+	}
+
+	//Status already shown by plan
+	logger.Debugln(appState.StatusMessage())
+
+	if plan.BackupDirectory != "" {
+		if err := backupFiles(logger, definition.RestoreFiles, appState.CurrentVersionFolder, plan.BackupDirectory); err != nil {
+			return err, "Cannot backup data, uninstall cancelled", EXIT_UNINSTALL_ERROR
+		}
+		logger.Infoln("Data kept in", plan.BackupDirectory)
+	}
+
+	var _errors []error
+
+	//Symlink first (avoid dangling link)
+	if plan.Symlink != "" {
+		logger.Debugln("Removing symlink", plan.Symlink)
+		if err := os.Remove(plan.Symlink); err != nil {
+			_errors = append(_errors, err)
+		}
+	}
+
+	for _, versionFolder := range plan.VersionFolders {
+		logger.Debugln("Removing", versionFolder.Folder)
+		if err := os.RemoveAll(versionFolder.Folder); err != nil {
+			_errors = append(_errors, err)
+		} else if err := state.ForgetInstalls(filepath.Dir(versionFolder.Folder), filepath.Base(versionFolder.Folder)); err != nil {
+			logger.Warnln("Cannot update install state |", err)
+		}
+	}
+
+	if plan.Shortcut != "" {
+		logger.Debugln("Removing shortcut", plan.Shortcut)
+		if err := os.Remove(plan.Shortcut); err != nil {
+			_errors = append(_errors, err)
+		}
+	}
+
+	for _, archive := range plan.Archives {
+		logger.Debugln("Removing archive", archive)
+		if err := os.Remove(archive); err != nil {
+			_errors = append(_errors, err)
+		}
+	}
+
+	if err := errors.Join(_errors...); err != nil {
+		return err, "Uninstall not complete", EXIT_UNINSTALL_ERROR
+	}
+
+	if plan.DataDirectory != "" {
+		logger.Infoln("Persisted data kept in", plan.DataDirectory)
+	}
+
+	logger.Infoln(appState.SuccessMessage())
+	return nil, "", EXIT_OK
+}
+
+// backupFiles copies files from an installed version to a backup directory
+func backupFiles(logger *log.Logger, files []string, source string, backupDirectory string) error {
+	if err := os.MkdirAll(backupDirectory, os.ModePerm); err != nil {
+		return err
+	}
+	_, err := restoreFiles(logger, files, source, backupDirectory)
+	return err
+}
+
+// findArchives lists downloaded archives (including .bad ones) of an app (app-version.ext)
+func findArchives(archivesDir string, app string) (archives []string) {
+	if !helper.FileOrDirExists(archivesDir) {
+		return
+	}
+
+	files, err := os.ReadDir(archivesDir)
+	if err != nil {
+		log.Errorln("Cannot read", archivesDir, "|", err)
+		return
+	}
+
+	prefix := fmt.Sprint(app, "-")
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		//Avoid matching app-extra-1.0.zip for app (version must follow)
+		if remaining, found := strings.CutPrefix(f.Name(), prefix); found && remaining != "" && unicode.IsDigit(rune(remaining[0])) {
+			archives = append(archives, filepath.Join(archivesDir, f.Name()))
+		}
+	}
+	return
+}
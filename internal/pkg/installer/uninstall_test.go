@@ -0,0 +1,21 @@
+package installer
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_findArchives(t *testing.T) {
+	archivesDir := t.TempDir()
+	for _, name := range []string{"git-2.45.1.7sfx", "git-2.40.0.7sfx-2024-01-01X10_00_00.bad", "githubcli-2.51.0.zip", "git-extra-1.0.zip"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(archivesDir, name), []byte{}, os.ModePerm))
+	}
+
+	archives := findArchives(archivesDir, "git")
+
+	assert.Len(t, archives, 2)
+	assert.Contains(t, archives, filepath.Join(archivesDir, "git-2.45.1.7sfx"))
+	assert.Contains(t, archives, filepath.Join(archivesDir, "git-2.40.0.7sfx-2024-01-01X10_00_00.bad"))
+}
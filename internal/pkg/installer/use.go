@@ -0,0 +1,135 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"path/filepath"
+)
+
+// Use repoints app symlink to an already installed version (no download)
+// If targetVersion is nil, previous installed version is used (rollback)
+// appState target version and status are updated accordingly
+func Use(ctx context.Context, appState *state.AppState, targetVersion *version.Version, customAppLocationForShortcut string, restore bool) (err error, errorMessage string, exitCode int) {
+
+	//Aliases
+	definition := appState.Definition
+	appName := definition.ApplicationName
+
+	//Logs prefixed with app name
+	logger := appState.Logger()
+
+	//Enforce validation
+	if valid, err := definition.IsValid(); !valid {
+		return err, "invalid definition", EXIT_INVALID_DEFINITION
+	}
+
+	versionFolders := state.FindVersionFolders(configuration.AppPath, appName)
+	if len(versionFolders) == 0 {
+		return nil, "not installed", EXIT_VERSION_NOT_INSTALLED
+	}
+
+	var target *state.VersionFolder
+	if targetVersion == nil {
+		target = previousVersionFolder(versionFolders, appState.CurrentVersion)
+		if target == nil {
+			return nil, fmt.Sprint("no version older than ", appState.CurrentVersion, " installed"), EXIT_VERSION_NOT_INSTALLED
+		}
+	} else {
+		target = findVersionFolder(versionFolders, targetVersion)
+		if target == nil {
+			return nil, fmt.Sprint("version ", targetVersion, " not installed (available: ", versionsOf(versionFolders), ")"), EXIT_VERSION_NOT_INSTALLED
+		}
+	}
+
+	appState.SetTargetVersion(target.Version)
+	symlink := filepath.Join(configuration.AppPath, definition.Symlink)
+	absoluteTarget, _ := filepath.Abs(target.Folder)
+	if appState.Status == state.KEEP && helper.GetSymlinkTarget(symlink) == absoluteTarget {
+		logger.Infoln("already using version", target.Version)
+		return nil, "", EXIT_OK
+	}
+
+	logger.Infoln(appState.StatusMessage())
+
+	journal, err := state.StartJournal(configuration.AppPath, "use", appName, filepath.Base(target.Folder))
+	if err != nil {
+		return err, "Cannot start journal", EXIT_SYMLINK_ERROR
+	}
+	tx := newTransaction(logger, journal)
+	defer tx.rollback() //nothing to undo once committed
+
+	//Version may have been installed before Persist was set (persisted data seeded by this use is not kept on failure)
+	if dataFolder := dataDirectory(appName); len(definition.Persist) > 0 && !helper.FileOrDirExists(dataFolder) {
+		if err := tx.begin(stepData, map[string]string{"data": dataFolder}); err != nil {
+			return err, "Cannot use version", EXIT_SYMLINK_ERROR
+		}
+		tx.onRollback(fmt.Sprint("remove ", dataFolder), removeAll(dataFolder))
+	}
+	if err := persistData(logger, tx, *definition, appState.CurrentVersionFolder, target.Folder); err != nil {
+		return err, fmt.Sprint("Cannot persist ", definition.Persist), EXIT_SYMLINK_ERROR
+	}
+
+	//Nomad binary is only replaced by a verified one
+	database, err := state.LoadDatabase(configuration.AppPath)
+	if err != nil {
+		logger.Warnln("Cannot read install state |", err)
+	}
+	record, _ := database.Record(filepath.Base(target.Folder))
+	symlink, err = handleSymlink(logger, tx, *appState, target.Folder, record.Signed)
+	if err != nil {
+		return err, "Symlink issue", EXIT_SYMLINK_ERROR
+	}
+
+	//Shortcut may embed version (filled in a copy, definition is shared)
+	shortcutDefinition := *definition
+	shortcutDefinition.Shortcut = fill(logger, definition.Shortcut, renderValues(*definition, target.Version, target.Folder))
+	if err = handleShortcut(logger, shortcutDefinition, symlink, customAppLocationForShortcut, configuration.DefaultShortcutsDir); err != nil {
+		return err, fmt.Sprint("Cannot create shortcut dir ", configuration.DefaultShortcutsDir), EXIT_SHORTCUT_ERROR
+	}
+
+	//Config from the version being left, once nothing can fail anymore (not undone)
+	if restore && appState.Status != state.KEEP {
+		files := notPersisted(*definition)
+		logger.Traceln("Restoring files folders:", files)
+		if _, err := restoreFiles(logger, files, appState.CurrentVersionFolder, target.Folder); err != nil {
+			logger.Errorln("Error restoring files:", files, "|", err)
+		}
+	}
+	tx.commit()
+
+	logger.Infoln(appState.SuccessMessage())
+	return nil, "", EXIT_OK
+}
+
+func findVersionFolder(versionFolders []state.VersionFolder, wanted *version.Version) *state.VersionFolder {
+	for i, versionFolder := range versionFolders {
+		if !versionFolder.Version.IsNewerThan(wanted) && !wanted.IsNewerThan(versionFolder.Version) {
+			return &versionFolders[i]
+		}
+	}
+	return nil
+}
+
+// previousVersionFolder returns the newest version older than current (folders are sorted from oldest to newest)
+func previousVersionFolder(versionFolders []state.VersionFolder, current *version.Version) *state.VersionFolder {
+	if current == nil {
+		return nil
+	}
+	for i := len(versionFolders) - 1; i >= 0; i-- {
+		if current.IsNewerThan(versionFolders[i].Version) {
+			return &versionFolders[i]
+		}
+	}
+	return nil
+}
+
+func versionsOf(versionFolders []state.VersionFolder) (versions []string) {
+	for _, versionFolder := range versionFolders {
+		versions = append(versions, versionFolder.Version.String())
+	}
+	return
+}
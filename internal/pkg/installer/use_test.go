@@ -0,0 +1,71 @@
+package installer
+
+import (
+	"context"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"github.com/jonathanMelly/nomad/internal/pkg/state"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_previousVersionFolder(t *testing.T) {
+	var versionFolders []state.VersionFolder
+	for _, v := range []string{"1.0.0", "1.2.0", "2.0.0"} {
+		parsed, _ := version.FromString(v)
+		versionFolders = append(versionFolders, state.VersionFolder{Version: parsed, Folder: "app-" + v})
+	}
+
+	current, _ := version.FromString("2.0.0")
+	assert.Equal(t, "app-1.2.0", previousVersionFolder(versionFolders, current).Folder)
+
+	current, _ = version.FromString("1.0.0")
+	assert.Nil(t, previousVersionFolder(versionFolders, current))
+
+	wanted, _ := version.FromString("1.2")
+	assert.Nil(t, findVersionFolder(versionFolders, wanted))
+	wanted, _ = version.FromString("1.2.0")
+	assert.Equal(t, "app-1.2.0", findVersionFolder(versionFolders, wanted).Folder)
+}
+
+func TestUseRestoreNotAppliedOnFailure(t *testing.T) {
+	appPath := configuration.AppPath
+	configuration.AppPath = t.TempDir()
+	defer func() { configuration.AppPath = appPath }()
+
+	previous := filepath.Join(configuration.AppPath, "app-1.0")
+	target := filepath.Join(configuration.AppPath, "app-2.0")
+	for folder, content := range map[string]string{previous: "mine", target: "default"} {
+		assert.NoError(t, os.MkdirAll(folder, os.ModePerm))
+		assert.NoError(t, os.WriteFile(filepath.Join(folder, "config.ini"), []byte(content), os.ModePerm))
+	}
+
+	//Symlink cannot be created (a folder is there)
+	symlink := filepath.Join(configuration.AppPath, "app")
+	assert.NoError(t, os.MkdirAll(filepath.Join(symlink, "blocking"), os.ModePerm))
+
+	currentVersion, _ := version.FromString("1.0")
+	targetVersion, _ := version.FromString("2.0")
+	appState := state.AppState{
+		Definition:           &data.AppDefinition{ApplicationName: "app", Symlink: "app", Version: "2.0", DownloadUrl: "https://example.org/app-{{VERSION}}.zip", RestoreFiles: []string{"config.ini"}},
+		CurrentVersion:       currentVersion,
+		CurrentVersionFolder: previous,
+	}
+	err, _, exitCode := Use(context.Background(), &appState, targetVersion, "", true)
+	assert.Err(t, err)
+	assert.Eq(t, EXIT_SYMLINK_ERROR, exitCode)
+	content, _ := os.ReadFile(filepath.Join(target, "config.ini"))
+	assert.Eq(t, "default", string(content))
+	entries, _ := os.ReadDir(target)
+	assert.Len(t, entries, 1) //no backup either
+
+	assert.NoError(t, os.RemoveAll(symlink))
+	err, _, exitCode = Use(context.Background(), &appState, targetVersion, "", true)
+	assert.NoError(t, err)
+	assert.Eq(t, EXIT_OK, exitCode)
+	content, _ = os.ReadFile(filepath.Join(target, "config.ini"))
+	assert.Eq(t, "mine", string(content))
+}
@@ -2,8 +2,12 @@ package installer
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gologme/log"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
 	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"github.com/jonathanMelly/nomad/internal/pkg/render"
 	"github.com/jonathanMelly/nomad/pkg/version"
 	"os"
 	"path/filepath"
@@ -11,23 +15,45 @@ import (
 	"time"
 )
 
-// writeScripts creates files from the app-definitions file
-func writeScripts(scripts map[string]string, appSpecificVersionFolder string, absoluteSymlinkToAppFolder string, version *version.Version) error {
+// renderValues exposes an app version to definition templates
+func renderValues(definition data.AppDefinition, targetVersion *version.Version, versionFolder string) render.Values {
+	absoluteSymlinkToApp, _ := filepath.Abs(filepath.Join(configuration.AppPath, definition.Symlink))
+	return render.Values{App: definition.ApplicationName, Version: targetVersion, AppPath: versionFolder, AppPathGeneric: absoluteSymlinkToApp, Templates: definition.Templates}
+}
+
+// fill renders a definition field, kept as is if it cannot be rendered (syntax is checked by IsValid)
+func fill(logger *log.Logger, input string, values render.Values) string {
+	output, err := render.String(input, values)
+	if err != nil {
+		logger.Errorln("Cannot render", input, "|", err)
+	}
+	return output
+}
+
+// writeScripts creates files from the app-definitions file (existing ones are kept unless overwrite is set)
+func writeScripts(logger *log.Logger, scripts map[string]string, appSpecificVersionFolder string, values render.Values, overwrite bool) error {
 	var _errors []error
 	// Loop through each script
 	for name, body := range scripts {
 
 		// Path of file
-		relativePath := strings.Replace(filepath.Join(appSpecificVersionFolder, name), "{{VERSION}}", version.String(), -1)
+		renderedName, err := render.String(name, values)
+		if err != nil {
+			_errors = append(_errors, err)
+			continue
+		}
+		relativePath := filepath.Join(appSpecificVersionFolder, renderedName)
 
 		// Write to file
-		if helper.FileOrDirExists(relativePath) {
-			log.Debugln(relativePath, "already in destination, skipping")
+		if helper.FileOrDirExists(relativePath) && !overwrite {
+			logger.Debugln(relativePath, "already in destination, skipping")
 		} else {
-			content := strings.Replace(body, "{{VERSION}}", version.String(), -1)
-			content = strings.Replace(content, "{{APP_PATH_GENERIC}}", absoluteSymlinkToAppFolder, -1)
-			content = strings.Replace(content, "{{APP_PATH}}", appSpecificVersionFolder, -1)
-			err := os.WriteFile(relativePath, []byte(content), os.ModePerm)
+			content, err := render.String(body, values)
+			if err != nil {
+				_errors = append(_errors, fmt.Errorf("%s | %w", renderedName, err))
+				continue
+			}
+			err = os.WriteFile(relativePath, []byte(content), os.ModePerm)
 			if err != nil {
 				_errors = append(_errors, err)
 			}
@@ -79,16 +105,16 @@ func createFolders(folders []string, dstFolder string) error {
 	return errors.Join(_errors...)
 }
 
-// restore files from previous version (mainly for config)
-func restoreFiles(files []string, source string, destination string) error {
+// restore files from previous version (mainly for config), returns the ones found in source
+func restoreFiles(logger *log.Logger, files []string, source string, destination string) (restored []string, err error) {
 
 	if destination == "" || !helper.FileOrDirExists(destination) {
-		log.Debugln("Missing destination", destination, "for restore => restore operation cancelled")
-		return nil
+		logger.Debugln("Missing destination", destination, "for restore => restore operation cancelled")
+		return nil, nil
 	}
 	if source == "" || !helper.FileOrDirExists(source) {
-		log.Debugln("Missing source", source, " for restore => restore operation cancelled")
-		return nil
+		logger.Debugln("Missing source", source, " for restore => restore operation cancelled")
+		return nil, nil
 	}
 
 	// Loop through each folder
@@ -97,56 +123,57 @@ func restoreFiles(files []string, source string, destination string) error {
 		sourcePath := filepath.Join(source, file)
 
 		if helper.FileOrDirExists(sourcePath) {
+			restored = append(restored, file)
 			if helper.IsDirectory(sourcePath) {
 				err := filepath.Walk(sourcePath, func(walkingPath string, fileInfo os.FileInfo, _ error) error {
 
 					//walk walks given folder as well...
 					if walkingPath != sourcePath && !fileInfo.IsDir() {
-						log.Traceln("=>Walking " + walkingPath)
+						logger.Traceln("=>Walking " + walkingPath)
 						destSubPath := strings.Join(strings.Split(walkingPath, string(os.PathSeparator))[2:], string(os.PathSeparator))
-						restore(walkingPath, filepath.Join(destination, destSubPath))
+						restore(logger, walkingPath, filepath.Join(destination, destSubPath))
 					}
 
 					return nil
 				})
 
 				if err != nil {
-					log.Warnln("Cannot walk source "+sourcePath+", skipping|", err)
+					logger.Warnln("Cannot walk source "+sourcePath+", skipping|", err)
 				}
 			} else {
 				destinationPath := filepath.Join(destination, file)
-				restore(sourcePath, destinationPath)
+				restore(logger, sourcePath, destinationPath)
 			}
 		} else {
-			log.Warnln(sourcePath, "does not exist, skipping restore")
+			logger.Warnln(sourcePath, "does not exist, skipping restore")
 		}
 
 	}
 
-	return nil
+	return restored, nil
 }
 
 // Copy source to upcoming location
-func restore(sourcePath string, destinationPath string) {
-	log.Debugln("==> restoring " + sourcePath + " -> " + destinationPath)
+func restore(logger *log.Logger, sourcePath string, destinationPath string) {
+	logger.Debugln("==> restoring " + sourcePath + " -> " + destinationPath)
 	stat, err := os.Stat(sourcePath)
 	if err != nil {
-		log.Errorln("Cannot stat source ", sourcePath, ", skipping|", err)
+		logger.Errorln("Cannot stat source ", sourcePath, ", skipping|", err)
 		return
 	}
 	bytesRead, err := os.ReadFile(sourcePath)
 	if err != nil {
-		log.Errorln("Cannot read source ", sourcePath, ", skipping|", err)
+		logger.Errorln("Cannot read source ", sourcePath, ", skipping|", err)
 	} else {
 		if helper.FileOrDirExists(destinationPath) {
-			log.Debugln(destinationPath, " already exists, trying to backup")
+			logger.Debugln(destinationPath, " already exists, trying to backup")
 			newpath := destinationPath + "-" + time.Now().Format("2006-01-02-15h04m05s")
 			err := os.Rename(destinationPath, newpath)
 			if err != nil {
-				log.Errorln("Cannot rename ", destinationPath, "to", newpath, ", skipping|", err)
+				logger.Errorln("Cannot rename ", destinationPath, "to", newpath, ", skipping|", err)
 				return
 			} else {
-				log.Debugln("Backuped ", destinationPath, " to ", newpath)
+				logger.Debugln("Backuped ", destinationPath, " to ", newpath)
 			}
 		}
 
@@ -155,18 +182,18 @@ func restore(sourcePath string, destinationPath string) {
 		if !helper.FileOrDirExists(destinationDirectory) {
 			err := os.MkdirAll(destinationDirectory, os.ModePerm)
 			if err != nil {
-				log.Errorln("Cannot mkdir ", destinationDirectory, ", aborting restore of ", destinationPath, " |", err)
+				logger.Errorln("Cannot mkdir ", destinationDirectory, ", aborting restore of ", destinationPath, " |", err)
 				return
 			} else {
-				log.Debugln(destinationDirectory, " created")
+				logger.Debugln(destinationDirectory, " created")
 			}
 		}
 
 		err = os.WriteFile(destinationPath, bytesRead, stat.Mode())
 		if err != nil {
-			log.Errorln("Cannot write destination ", destinationPath, ", restore failed |", err)
+			logger.Errorln("Cannot write destination ", destinationPath, ", restore failed |", err)
 		} else {
-			log.Debugln(sourcePath, " restored into ", destinationPath)
+			logger.Debugln(sourcePath, " restored into ", destinationPath)
 		}
 	}
 }
@@ -0,0 +1,32 @@
+package installer
+
+import (
+	"github.com/gologme/log"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/render"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_writeScripts(t *testing.T) {
+	folder := t.TempDir()
+	scripts := map[string]string{"run-{{VERSION}}.bat": "{{APP_PATH_GENERIC}}\\app.exe {{.App}}"}
+	appVersion, _ := version.FromString("1.0")
+	values := render.Values{App: "demo", Version: appVersion, AppPath: folder, AppPathGeneric: "C:\\apps\\demo", Templates: true}
+
+	assert.NoError(t, writeScripts(log.Default(), scripts, folder, values, false))
+	script := filepath.Join(folder, "run-1.0.bat")
+	content, _ := os.ReadFile(script)
+	assert.Equal(t, "C:\\apps\\demo\\app.exe demo", string(content))
+
+	//Existing files are kept unless overwrite is set
+	values.App = "other"
+	assert.NoError(t, writeScripts(log.Default(), scripts, folder, values, false))
+	content, _ = os.ReadFile(script)
+	assert.Equal(t, "C:\\apps\\demo\\app.exe demo", string(content))
+	assert.NoError(t, writeScripts(log.Default(), scripts, folder, values, true))
+	content, _ = os.ReadFile(script)
+	assert.Equal(t, "C:\\apps\\demo\\app.exe other", string(content))
+}
@@ -0,0 +1,89 @@
+package render
+
+import (
+	"fmt"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// Values are available as placeholders ({{VERSION}}, {{APP_PATH}}, {{OS}}...)
+// and, if Templates is set, as template fields ({{.App}}, {{.Version}}...)
+type Values struct {
+	App            string
+	Version        *version.Version
+	AppPath        string //version folder
+	AppPathGeneric string //absolute symlink to current version
+	Templates      bool   //input is a text/template, else only placeholders are replaced (other braces kept as is)
+}
+
+// legacy returns simple placeholders (pre-template ones kept for existing definitions, plus OS and ARCH)
+func (values Values) legacy() map[string]string {
+	placeholders := map[string]string{}
+	if values.Version != nil {
+		placeholders = values.Version.Placeholders()
+	} else {
+		for name := range (version.Version{}).Placeholders() {
+			placeholders[name] = ""
+		}
+	}
+	placeholders["OS"] = runtime.GOOS
+	placeholders["ARCH"] = runtime.GOARCH
+	placeholders["APP_PATH"] = values.AppPath
+	placeholders["APP_PATH_GENERIC"] = values.AppPathGeneric
+	return placeholders
+}
+
+func (values Values) funcs() template.FuncMap {
+	funcs := template.FuncMap{
+		"env":  os.Getenv,
+		"os":   func() string { return runtime.GOOS },
+		"arch": func() string { return runtime.GOARCH },
+		//Inputs may be any value (ex: .Version)
+		"lower": func(input any) string { return strings.ToLower(fmt.Sprint(input)) },
+		"upper": func(input any) string { return strings.ToUpper(fmt.Sprint(input)) },
+		//Last argument is the piped value: {{.Version | replace "." ""}}
+		"replace": func(old string, new string, input any) string { return strings.ReplaceAll(fmt.Sprint(input), old, new) },
+		"join":    func(elements ...string) string { return filepath.Join(elements...) },
+	}
+	for name, value := range values.legacy() {
+		value := value
+		funcs[name] = func() string { return value }
+	}
+	return funcs
+}
+
+func parse(input string, values Values) (*template.Template, error) {
+	return template.New("").Funcs(values.funcs()).Parse(input)
+}
+
+// Check reports template syntax errors and unknown functions/placeholders of input (values are not needed)
+func Check(input string) error {
+	_, err := parse(input, Values{})
+	return err
+}
+
+// String renders input with values (text/template syntax if values.Templates is set)
+func String(input string, values Values) (string, error) {
+	if !strings.Contains(input, "{{") {
+		return input, nil
+	}
+	if !values.Templates {
+		for name, value := range values.legacy() {
+			input = strings.ReplaceAll(input, fmt.Sprint("{{", name, "}}"), value)
+		}
+		return input, nil
+	}
+	tmpl, err := parse(input, values)
+	if err != nil {
+		return input, err
+	}
+	output := strings.Builder{}
+	if err := tmpl.Execute(&output, values); err != nil {
+		return input, err
+	}
+	return output.String(), nil
+}
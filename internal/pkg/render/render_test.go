@@ -0,0 +1,60 @@
+package render
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/pkg/version"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	assert.NoError(t, os.Setenv("NOMAD_RENDER_TEST", "bob"))
+	defer os.Unsetenv("NOMAD_RENDER_TEST")
+
+	appVersion, _ := version.FromString("1.2.3")
+	values := Values{App: "demo", Version: appVersion, AppPath: "apps/demo-1.2.3", AppPathGeneric: "/abs/apps/demo", Templates: true}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"no template", "https://example.org/app.zip", "https://example.org/app.zip", false},
+		{"legacy", "app-{{VERSION}}-{{V_MAJOR}}.{{V_MINOR}}-{{VERSION_NO_DOT}}", "app-1.2.3-1.2-123", false},
+		{"legacy paths", "{{APP_PATH}} {{APP_PATH_GENERIC}}", "apps/demo-1.2.3 /abs/apps/demo", false},
+		{"fields", "{{.App}}-{{.Version}}", "demo-1.2.3", false},
+		{"functions", `{{.Version | replace "." "_"}} {{upper .App}} {{env "NOMAD_RENDER_TEST"}}`, "1_2_3 DEMO bob", false},
+		{"os arch", "{{os}}-{{arch}}", runtime.GOOS + "-" + runtime.GOARCH, false},
+		{"conditional", `{{if eq os "windows"}}app.exe{{else}}app{{end}}`, map[bool]string{true: "app.exe", false: "app"}[runtime.GOOS == "windows"], false},
+		{"join", `{{join .AppPath "bin"}}`, filepath.Join("apps/demo-1.2.3", "bin"), false},
+		{"unknown placeholder", "{{UNKNOWN}}", "{{UNKNOWN}}", true},
+		{"syntax", "{{.App", "{{.App", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := String(tt.input, values)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantErr, Check(tt.input) != nil)
+		})
+	}
+}
+
+func TestStringPlaceholdersOnly(t *testing.T) {
+	appVersion, _ := version.FromString("1.2.3")
+	values := Values{App: "demo", Version: appVersion, AppPath: "apps/demo-1.2.3"}
+
+	//Without opt-in, other braces are literal (scripts, configs...)
+	got, err := String(`app-{{VERSION}} {{OS}} {{APP_PATH}} {{.App}} {{UNKNOWN}} {{ "json": 1 }} ${{x}`, values)
+	assert.NoError(t, err)
+	assert.Equal(t, "app-1.2.3 "+runtime.GOOS+` apps/demo-1.2.3 {{.App}} {{UNKNOWN}} {{ "json": 1 }} ${{x}`, got)
+}
+
+func TestStringWithoutVersion(t *testing.T) {
+	got, err := String("app{{VERSION}}", Values{})
+	assert.NoError(t, err)
+	assert.Equal(t, "app", got)
+}
@@ -0,0 +1,138 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InstallRecord describes an installed version folder
+type InstallRecord struct {
+	App           string    `json:"app"`
+	Version       string    `json:"version"`
+	Source        string    `json:"source"` //definition source (embedded, custom, nomad.toml)
+	DownloadUrl   string    `json:"downloadUrl"`
+	Sha256        string    `json:"sha256"` //of archive
+	Signed        bool      `json:"signed"` //archive signature verified before extraction
+	InstalledAt   time.Time `json:"installedAt"`
+	Nomad         string    `json:"nomad"` //version which installed it
+	RestoredFiles []string  `json:"restoredFiles"`
+}
+
+// Database records installs in StateFileName under apps root (by version folder name)
+// Folders not found in it (installed by older nomad versions) are identified from their name (see GuessAppAndVersion)
+type Database struct {
+	Installs map[string]InstallRecord `json:"installs"`
+}
+
+// Protects database file when apps are installed concurrently
+var databaseMutex sync.Mutex
+
+func databasePath(baseDirectory string) string {
+	return filepath.Join(baseDirectory, configuration.StateFileName)
+}
+
+// LoadDatabase reads state file of baseDirectory (empty database if missing)
+func LoadDatabase(baseDirectory string) (Database, error) {
+	database := Database{Installs: map[string]InstallRecord{}}
+	content, err := os.ReadFile(databasePath(baseDirectory))
+	if errors.Is(err, os.ErrNotExist) {
+		return database, nil
+	} else if err != nil {
+		return database, err
+	}
+	if err := json.Unmarshal(content, &database); err != nil {
+		return Database{Installs: map[string]InstallRecord{}}, err
+	}
+	if database.Installs == nil {
+		database.Installs = map[string]InstallRecord{}
+	}
+	return database, nil
+}
+
+// save writes state file (through a temporary file to never leave a truncated one)
+func (database Database) save(baseDirectory string) error {
+	content, err := json.MarshalIndent(database, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporaryPath := databasePath(baseDirectory) + ".tmp"
+	if err := os.WriteFile(temporaryPath, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, databasePath(baseDirectory))
+}
+
+// Identify returns app and version of a version folder (from database, else guessed from its name)
+func (database Database) Identify(folder string) (app string, versionString string, found bool) {
+	if database.IsDataFolder(folder) {
+		return "", "", false
+	}
+	if record, recorded := database.Installs[folder]; recorded {
+		return record.App, record.Version, true
+	}
+	return GuessAppAndVersion(folder)
+}
+
+// IsDataFolder tells if a folder holds persisted data of a known app (defined or recorded), not a version
+func (database Database) IsDataFolder(folder string) bool {
+	app, suffixed := strings.CutSuffix(folder, configuration.DataDirectorySuffix)
+	if !suffixed || app == "" {
+		return false
+	}
+	if _, defined := configuration.Settings.AppDefinitions[app]; defined {
+		return true
+	}
+	for _, record := range database.Installs {
+		if record.App == app {
+			return true
+		}
+	}
+	return false
+}
+
+// Record returns the record of a version folder, if any
+func (database Database) Record(folder string) (InstallRecord, bool) {
+	record, found := database.Installs[folder]
+	return record, found
+}
+
+// RecordInstall adds/replaces the record of a version folder
+func RecordInstall(baseDirectory string, folder string, record InstallRecord) error {
+	databaseMutex.Lock()
+	defer databaseMutex.Unlock()
+
+	database, err := LoadDatabase(baseDirectory)
+	if err != nil {
+		return err
+	}
+	database.Installs[folder] = record
+	return database.save(baseDirectory)
+}
+
+// ForgetInstalls removes records of deleted version folders (unknown folders are ignored)
+func ForgetInstalls(baseDirectory string, folders ...string) error {
+	databaseMutex.Lock()
+	defer databaseMutex.Unlock()
+
+	database, err := LoadDatabase(baseDirectory)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, folder := range folders {
+		if _, found := database.Installs[folder]; found {
+			delete(database.Installs, folder)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return database.save(baseDirectory)
+}
@@ -0,0 +1,71 @@
+package state
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/data"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDatabase(t *testing.T) {
+	baseDirectory := t.TempDir()
+
+	//Missing file
+	database, err := LoadDatabase(baseDirectory)
+	assert.NoError(t, err)
+	assert.Len(t, database.Installs, 0)
+
+	assert.NoError(t, RecordInstall(baseDirectory, "custom-folder", InstallRecord{App: "my-app", Version: "2.1", RestoredFiles: []string{"config"}}))
+	assert.NoError(t, RecordInstall(baseDirectory, "other-1.0", InstallRecord{App: "other", Version: "1.0"}))
+	assert.NoError(t, ForgetInstalls(baseDirectory, "other-1.0", "unknown-1.0"))
+
+	database, err = LoadDatabase(baseDirectory)
+	assert.NoError(t, err)
+	assert.Len(t, database.Installs, 1)
+	record, found := database.Record("custom-folder")
+	assert.True(t, found)
+	assert.Eq(t, []string{"config"}, record.RestoredFiles)
+
+	//Recorded first, folder name as fallback
+	app, versionString, found := database.Identify("custom-folder")
+	assert.True(t, found)
+	assert.Eq(t, "my-app", app)
+	assert.Eq(t, "2.1", versionString)
+	app, versionString, found = database.Identify("my-app-1.0")
+	assert.True(t, found)
+	assert.Eq(t, "my-app", app)
+	assert.Eq(t, "1.0", versionString)
+
+	_, _, found = database.Identify("my-app-data")
+	assert.False(t, found) //persisted data
+	assert.True(t, database.IsDataFolder("my-app-data"))
+	assert.False(t, database.IsDataFolder("big-data")) //no such app
+	assert.False(t, database.IsDataFolder("-data"))
+
+	//Corrupted file
+	assert.NoError(t, os.WriteFile(filepath.Join(baseDirectory, configuration.StateFileName), []byte("{"), os.ModePerm))
+	database, err = LoadDatabase(baseDirectory)
+	assert.Err(t, err)
+	assert.Len(t, database.Installs, 0)
+}
+
+func TestScanCurrentAppsUsesDatabase(t *testing.T) {
+	baseDirectory := t.TempDir()
+	previous := configuration.Settings.AppDefinitions
+	defer func() { configuration.Settings.AppDefinitions = previous }()
+	configuration.Settings.AppDefinitions = map[string]*data.AppDefinition{"my-app": {ApplicationName: "my-app"}}
+
+	//Folder name cannot be guessed (my-app-custom => app "my-app" with version "custom")
+	assert.NoError(t, os.Mkdir(filepath.Join(baseDirectory, "my-app-custom"), os.ModePerm))
+	assert.NoError(t, RecordInstall(baseDirectory, "my-app-custom", InstallRecord{App: "my-app", Version: "2.1"}))
+
+	states := ScanCurrentApps(baseDirectory)
+	assert.Len(t, states, 1)
+	assert.Eq(t, "2.1", states["my-app"].CurrentVersion.String())
+
+	folders := FindVersionFolders(baseDirectory, "my-app")
+	assert.Len(t, folders, 1)
+	assert.Eq(t, "2.1", folders[0].Version.String())
+}
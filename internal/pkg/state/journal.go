@@ -0,0 +1,154 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Journal records the intent of an operation changing apps tree before each step
+// It is removed once the operation is complete (or undone), thus a journal left behind
+// (crash, power loss, killed process) tells what must be finished or undone (see nomad recover)
+type Journal struct {
+	Operation string        `json:"operation"` //install, use...
+	App       string        `json:"app"`
+	Folder    string        `json:"folder"` //version folder name
+	Started   time.Time     `json:"started"`
+	Steps     []JournalStep `json:"steps"`
+
+	path string
+}
+
+// JournalStep is written before the step is applied and marked done after
+type JournalStep struct {
+	Name  string            `json:"name"`
+	Paths map[string]string `json:"paths"` //touched paths by role
+	Done  bool              `json:"done"`
+}
+
+func journalDirectory(baseDirectory string) string {
+	return filepath.Join(baseDirectory, configuration.JournalDir)
+}
+
+// StartJournal writes the journal of a new operation on an app
+func StartJournal(baseDirectory string, operation string, app string, folder string) (*Journal, error) {
+	if err := os.MkdirAll(journalDirectory(baseDirectory), os.ModePerm); err != nil {
+		return nil, err
+	}
+	journal := &Journal{
+		Operation: operation,
+		App:       app,
+		Folder:    folder,
+		Started:   time.Now(),
+		path:      filepath.Join(journalDirectory(baseDirectory), fmt.Sprint(operation, "-", app, ".json")),
+	}
+	if _, err := os.Stat(journal.path); err == nil {
+		return nil, errors.New(fmt.Sprint("unfinished ", operation, " of ", app, " found (", journal.path, "), please run recover first"))
+	}
+	return journal, journal.save()
+}
+
+// Begin records the intent of a step (before applying it)
+func (journal *Journal) Begin(name string, paths map[string]string) error {
+	journal.Steps = append(journal.Steps, JournalStep{Name: name, Paths: paths})
+	return journal.save()
+}
+
+// Done marks the last begun step as applied
+func (journal *Journal) Done() error {
+	if len(journal.Steps) == 0 {
+		return nil
+	}
+	journal.Steps[len(journal.Steps)-1].Done = true
+	return journal.save()
+}
+
+// Step returns the last recorded step with the given name (nil if none)
+func (journal *Journal) Step(name string) *JournalStep {
+	for index := len(journal.Steps) - 1; index >= 0; index-- {
+		if journal.Steps[index].Name == name {
+			return &journal.Steps[index]
+		}
+	}
+	return nil
+}
+
+func (journal *Journal) String() string {
+	return fmt.Sprint(journal.Operation, " of ", journal.Folder, " started ", journal.Started.Format(time.DateTime))
+}
+
+// Path of the journal file
+func (journal *Journal) Path() string {
+	return journal.path
+}
+
+// Close removes the journal (operation complete or undone)
+func (journal *Journal) Close() error {
+	if err := os.Remove(journal.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// save writes the journal to disk (synced, through a temporary file to never leave a truncated one)
+func (journal *Journal) save() error {
+	content, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporaryPath := journal.path + ".tmp"
+	file, err := os.OpenFile(temporaryPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, journal.path)
+}
+
+// UnfinishedJournals lists journals left in baseDirectory (oldest first)
+// Unreadable journals are returned as errors (they must be checked manually)
+func UnfinishedJournals(baseDirectory string) (journals []*Journal, err error) {
+	entries, err := os.ReadDir(journalDirectory(baseDirectory))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(journalDirectory(baseDirectory), entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		journal := &Journal{path: path}
+		if err := json.Unmarshal(content, journal); err != nil {
+			errs = append(errs, errors.New(fmt.Sprint("corrupted journal ", path, " | ", err)))
+			continue
+		}
+		journals = append(journals, journal)
+	}
+	sort.Slice(journals, func(i, j int) bool { return journals[i].Started.Before(journals[j].Started) })
+	return journals, errors.Join(errs...)
+}
@@ -0,0 +1,55 @@
+package state
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	baseDirectory := t.TempDir()
+
+	//Nothing yet
+	journals, err := UnfinishedJournals(baseDirectory)
+	assert.NoError(t, err)
+	assert.Len(t, journals, 0)
+
+	journal, err := StartJournal(baseDirectory, "install", "my-app", "my-app-1.0")
+	assert.NoError(t, err)
+	assert.NoError(t, journal.Begin("stage", map[string]string{"staging": "/tmp/staging"}))
+	assert.NoError(t, journal.Done())
+	assert.NoError(t, journal.Begin("promote", map[string]string{"target": "/tmp/target"}))
+
+	//Same operation on the same app must be recovered first
+	_, err = StartJournal(baseDirectory, "install", "my-app", "my-app-1.0")
+	assert.ErrSubMsg(t, err, "please run recover")
+
+	journals, err = UnfinishedJournals(baseDirectory)
+	assert.NoError(t, err)
+	assert.Len(t, journals, 1)
+	assert.Eq(t, "my-app", journals[0].App)
+	assert.Len(t, journals[0].Steps, 2)
+	assert.True(t, journals[0].Step("stage").Done)
+	assert.False(t, journals[0].Step("promote").Done)
+	assert.Eq(t, "/tmp/target", journals[0].Step("promote").Paths["target"])
+	assert.Nil(t, journals[0].Step("symlink"))
+
+	assert.NoError(t, journals[0].Close())
+	journals, err = UnfinishedJournals(baseDirectory)
+	assert.NoError(t, err)
+	assert.Len(t, journals, 0)
+}
+
+func TestUnfinishedJournalsCorrupted(t *testing.T) {
+	baseDirectory := t.TempDir()
+	_, err := StartJournal(baseDirectory, "use", "my-app", "my-app-1.0")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(baseDirectory, configuration.JournalDir, "install-other.json"), []byte("{\"app\":"), os.ModePerm))
+
+	journals, err := UnfinishedJournals(baseDirectory)
+	assert.ErrSubMsg(t, err, "corrupted journal")
+	assert.Len(t, journals, 1)
+	assert.Eq(t, "use", journals[0].Operation)
+}
@@ -0,0 +1,131 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofrs/flock"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrBusy tells that apps directory is being changed by another nomad process
+var ErrBusy = errors.New("apps directory is being changed by another nomad process")
+
+// Advisory lock timings
+var (
+	LockGrace      = time.Second            //min wait (a read-only command may be peeking at the lock)
+	LockRetryDelay = 200 * time.Millisecond //between 2 attempts while waiting
+)
+
+// ProcessLock is held by the nomad process changing apps directory (installs, symlinks, archives...)
+// It relies on an OS lock (released even if the process is killed) and tells who holds it in an info file
+// (a separate file as a locked file cannot be read on windows)
+type ProcessLock struct {
+	file     *flock.Flock
+	infoPath string
+}
+
+// ProcessInfo describes the holder of the lock
+type ProcessInfo struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+	Command string    `json:"command"`
+}
+
+func (info *ProcessInfo) String() string {
+	if info == nil {
+		return "unknown process"
+	}
+	return fmt.Sprint("pid ", info.PID, " on ", info.Host, " since ", info.Started.Format(time.DateTime), " (", info.Command, ")")
+}
+
+// LockApps takes the lock of baseDirectory, waiting up to wait for another process to release it
+// stale is set if a former holder stopped without releasing it (crash, killed...)
+func LockApps(ctx context.Context, baseDirectory string, wait time.Duration) (lock *ProcessLock, stale *ProcessInfo, err error) {
+	if err := os.MkdirAll(baseDirectory, os.ModePerm); err != nil {
+		return nil, nil, err
+	}
+	lock = &ProcessLock{
+		file:     flock.New(filepath.Join(baseDirectory, configuration.ProcessLockName)),
+		infoPath: filepath.Join(baseDirectory, configuration.ProcessInfoName),
+	}
+
+	waitContext, cancel := context.WithTimeout(ctx, max(wait, LockGrace))
+	defer cancel()
+	locked, err := lock.file.TryLockContext(waitContext, LockRetryDelay)
+	if !locked {
+		_ = lock.file.Close()
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		} else if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			return nil, nil, err
+		}
+		if holder := readProcessInfo(lock.infoPath); holder != nil {
+			return nil, nil, fmt.Errorf("%w (%s)", ErrBusy, holder)
+		}
+		return nil, nil, ErrBusy
+	}
+
+	stale = readProcessInfo(lock.infoPath)
+	hostname, _ := os.Hostname()
+	info := ProcessInfo{PID: os.Getpid(), Host: hostname, Started: time.Now(), Command: strings.Join(os.Args, " ")}
+	if err := writeProcessInfo(lock.infoPath, info); err != nil {
+		_ = lock.file.Close()
+		return nil, nil, err
+	}
+	return lock, stale, nil
+}
+
+// Unlock releases the lock (info removed first so that a new holder never sees it)
+func (lock *ProcessLock) Unlock() error {
+	err := os.Remove(lock.infoPath)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	//Lock file is kept: removing it would let 2 processes lock 2 different files
+	return errors.Join(err, lock.file.Close())
+}
+
+// AppsBusy tells (without waiting) if another process holds the lock of baseDirectory
+func AppsBusy(baseDirectory string) (holder *ProcessInfo, busy bool) {
+	lockPath := filepath.Join(baseDirectory, configuration.ProcessLockName)
+	if _, err := os.Stat(lockPath); err != nil {
+		return nil, false
+	}
+	file := flock.New(lockPath, flock.SetFlag(os.O_RDONLY))
+	defer file.Close()
+	if locked, err := file.TryRLock(); locked || err != nil {
+		return nil, false
+	}
+	return readProcessInfo(filepath.Join(baseDirectory, configuration.ProcessInfoName)), true
+}
+
+func readProcessInfo(path string) *ProcessInfo {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	info := &ProcessInfo{}
+	if err := json.Unmarshal(content, info); err != nil {
+		return &ProcessInfo{Command: "unreadable " + path}
+	}
+	return info
+}
+
+func writeProcessInfo(path string, info ProcessInfo) error {
+	content, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporaryPath := path + ".tmp"
+	if err := os.WriteFile(temporaryPath, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, path)
+}
@@ -0,0 +1,71 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/jonathanMelly/nomad/internal/pkg/configuration"
+	"github.com/jonathanMelly/nomad/internal/pkg/helper"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockApps(t *testing.T) {
+	defer func(grace time.Duration) { LockGrace = grace }(LockGrace)
+	LockGrace = 10 * time.Millisecond
+	baseDirectory := t.TempDir()
+
+	_, busy := AppsBusy(baseDirectory)
+	assert.False(t, busy)
+
+	lock, stale, err := LockApps(context.Background(), baseDirectory, 0)
+	assert.NoError(t, err)
+	assert.Nil(t, stale)
+
+	//Another process (another lock file handle behaves the same)
+	holder, busy := AppsBusy(baseDirectory)
+	assert.True(t, busy)
+	assert.Eq(t, os.Getpid(), holder.PID)
+	_, _, err = LockApps(context.Background(), baseDirectory, 50*time.Millisecond)
+	assert.True(t, errors.Is(err, ErrBusy))
+	assert.ErrSubMsg(t, err, "pid")
+
+	//Released while waiting
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = lock.Unlock()
+	}()
+	second, stale, err := LockApps(context.Background(), baseDirectory, 5*time.Second)
+	assert.NoError(t, err)
+	assert.Nil(t, stale)
+	assert.NoError(t, second.Unlock())
+	assert.False(t, helper.FileOrDirExists(filepath.Join(baseDirectory, configuration.ProcessInfoName)))
+}
+
+func TestLockAppsStale(t *testing.T) {
+	baseDirectory := t.TempDir()
+
+	//Holder killed (OS lock released, info left)
+	assert.NoError(t, writeProcessInfo(filepath.Join(baseDirectory, configuration.ProcessInfoName), ProcessInfo{PID: 42, Host: "host", Command: "nomad install"}))
+	_, busy := AppsBusy(baseDirectory)
+	assert.False(t, busy)
+
+	lock, stale, err := LockApps(context.Background(), baseDirectory, 0)
+	assert.NoError(t, err)
+	assert.Eq(t, 42, stale.PID)
+	assert.NoError(t, lock.Unlock())
+}
+
+func TestLockAppsCanceled(t *testing.T) {
+	baseDirectory := t.TempDir()
+	lock, _, err := LockApps(context.Background(), baseDirectory, 0)
+	assert.NoError(t, err)
+	defer lock.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = LockApps(ctx, baseDirectory, time.Minute)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
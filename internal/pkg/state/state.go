@@ -1,6 +1,7 @@
 package state
 
 import (
+	"context"
 	"fmt"
 	"github.com/gologme/log"
 	"github.com/gookit/goutil/maputil"
@@ -10,6 +11,7 @@ import (
 	"github.com/jonathanMelly/nomad/pkg/version"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -24,11 +26,28 @@ const (
 	UPGRADE   = Status(2)
 	DOWNGRADE = Status(3)
 
-	// NOT YET IMPLEMENTED UNINSTALL=4
+	UNINSTALL = Status(4)
 )
 
 type Status int
 
+func (status Status) String() string {
+	switch status {
+	case KEEP:
+		return "keep"
+	case INSTALL:
+		return "install"
+	case UPGRADE:
+		return "upgrade"
+	case DOWNGRADE:
+		return "downgrade"
+	case UNINSTALL:
+		return "uninstall"
+	default:
+		return "unknown"
+	}
+}
+
 type AppStates map[string]*AppState
 
 var wg sync.WaitGroup
@@ -44,6 +63,17 @@ type AppState struct {
 	TargetVersion        *version.Version
 	CurrentVersionFolder string
 	Status               Status
+	Locked               *data.LockedApp //pinned archive (frozen install)
+	Log                  *log.Logger     //app logger (see Logger)
+	Downloaded           int64           //archive bytes downloaded by last install/upgrade
+}
+
+// Logger returns the app logger (a live one prefixed with app name if none was set)
+func (state AppState) Logger() *log.Logger {
+	if state.Log != nil {
+		return state.Log
+	}
+	return helper.NewAppLogger(state.Definition.ApplicationName, log.Writer())
 }
 
 func FilterValidAskedApps(askedApps []string) (filtered []string) {
@@ -108,6 +138,7 @@ func ScanCurrentApps(baseDirectory string) AppStates {
 		if err != nil {
 			log.Fatal(err)
 		}
+		database := loadDatabaseOrGuess(baseDirectory)
 
 		alreadyAnalyzedThroughSymlinks := map[string]bool{}
 		for _, f := range files {
@@ -150,7 +181,7 @@ func ScanCurrentApps(baseDirectory string) AppStates {
 			}
 
 			if targetDirectory != "" {
-				analyzeEntry(baseDirectory, targetDirectory, installedApps, isLink)
+				analyzeEntry(database, baseDirectory, targetDirectory, installedApps, isLink)
 			}
 		}
 	} else {
@@ -160,15 +191,12 @@ func ScanCurrentApps(baseDirectory string) AppStates {
 	return installedApps
 }
 
-func analyzeEntry(rootPath string, appDirectory string, states AppStates, isSymlink bool) {
+func analyzeEntry(database Database, rootPath string, appDirectory string, states AppStates, isSymlink bool) {
 	fullPath := filepath.Join(rootPath, appDirectory)
 	log.Traceln("Analyzing", fullPath, "(from symlink:", isSymlink, ")")
 
-	const VersionSeparator = "-"
-	lastSeparatorPosition := strings.LastIndex(appDirectory, VersionSeparator)
-	if lastSeparatorPosition >= 0 {
-		guessedApp := appDirectory[:lastSeparatorPosition]
-		guessedVersionString := appDirectory[lastSeparatorPosition+1:]
+	guessedApp, guessedVersionString, found := database.Identify(appDirectory)
+	if found {
 		log.Traceln("Guessed app", guessedApp, "with version", guessedVersionString)
 
 		guessedVersion, err := version.FromString(guessedVersionString)
@@ -195,8 +223,67 @@ func analyzeEntry(rootPath string, appDirectory string, states AppStates, isSyml
 			}
 		}
 	} else {
-		log.Traceln("No", VersionSeparator, "found in", fullPath, ", discarding entry")
+		log.Traceln("No", versionSeparator, "found in", fullPath, ", discarding entry")
+	}
+}
+
+const versionSeparator = "-"
+
+// loadDatabaseOrGuess falls back to an empty database (folder names only) if state file is unreadable
+func loadDatabaseOrGuess(baseDirectory string) Database {
+	database, err := LoadDatabase(baseDirectory)
+	if err != nil {
+		log.Warnln("Cannot read", databasePath(baseDirectory), "(apps will be identified from folder names) |", err)
+	}
+	return database
+}
+
+// GuessAppAndVersion splits an app directory name (app-version) on its last separator
+func GuessAppAndVersion(appDirectory string) (app string, versionString string, found bool) {
+	lastSeparatorPosition := strings.LastIndex(appDirectory, versionSeparator)
+	if lastSeparatorPosition >= 0 {
+		return appDirectory[:lastSeparatorPosition], appDirectory[lastSeparatorPosition+1:], true
 	}
+	return "", "", false
+}
+
+// VersionFolder is an installed app-version directory
+type VersionFolder struct {
+	Version *version.Version
+	Folder  string
+}
+
+// FindVersionFolders lists all app-version directories (not symlinks) of the given app, from oldest to newest
+func FindVersionFolders(baseDirectory string, app string) (folders []VersionFolder) {
+	if !helper.FileOrDirExists(baseDirectory) {
+		return
+	}
+
+	files, err := os.ReadDir(baseDirectory)
+	if err != nil {
+		log.Errorln("Cannot read", baseDirectory, "|", err)
+		return
+	}
+
+	database := loadDatabaseOrGuess(baseDirectory)
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		guessedApp, guessedVersionString, found := database.Identify(f.Name())
+		if found && guessedApp == app {
+			if guessedVersion, err := version.FromString(guessedVersionString); err == nil {
+				folders = append(folders, VersionFolder{Version: guessedVersion, Folder: filepath.Join(baseDirectory, f.Name())})
+			} else {
+				log.Traceln("Discarding", f.Name(), "(bad version format)")
+			}
+		}
+	}
+
+	sort.SliceStable(folders, func(i, j int) bool {
+		return folders[j].Version.IsNewerThan(folders[i].Version)
+	})
+	return
 }
 
 func addOrUpdateState(appPath string, guessedApp string, states AppStates, currentVersion *version.Version, isSymlink bool) {
@@ -219,7 +306,9 @@ func buildState(appPath string, knownAppDef data.AppDefinition, isSymlink bool,
 	}
 }
 
+// DeterminePossibleActions computes target versions (remote checks are stopped if ctx is canceled)
 func DeterminePossibleActions(
+	ctx context.Context,
 	apps AppStates,
 	forceVersion string,
 	useLatestVersion bool, apiKey string) error {
@@ -231,35 +320,34 @@ func DeterminePossibleActions(
 		return err
 	}
 
-	defer log.SetPrefix("")
 	wg.Add(len(apps))
-	for appName, state := range apps {
-		go computeState(appName, state, useLatestVersion, apiKey, forcedVersion)
+	for _, state := range apps {
+		go computeState(ctx, state, useLatestVersion, apiKey, forcedVersion)
 	}
 	wg.Wait()
 
-	return nil
+	return ctx.Err()
 
 }
 
-func computeState(appName string, state *AppState, useLatestVersion bool, apiKey string, forcedVersion *version.Version) {
+func computeState(ctx context.Context, state *AppState, useLatestVersion bool, apiKey string, forcedVersion *version.Version) {
 	defer wg.Done()
-	log.SetPrefix(fmt.Sprint("|", appName, "| "))
+	logger := state.Logger()
 
 	var configVersion *version.Version = nil
 	if state.Definition.Version != "" {
 		var err error
 		configVersion, err = version.FromString(state.Definition.Version)
 		if err != nil {
-			log.Errorln("Bad version format in config : ", state.Definition.Version, "|", err)
+			logger.Errorln("Bad version format in config : ", state.Definition.Version, "|", err)
 		}
 	}
 
-	log.Debugln("Version from config: ", configVersion)
+	logger.Debugln("Version from config: ", configVersion)
 
 	//Current version
 	currentInstalledVersion := state.CurrentVersion
-	log.Debugln("Version installed: ", currentInstalledVersion)
+	logger.Debugln("Version installed: ", currentInstalledVersion)
 
 	var latestVersionFromRemote *version.Version = nil
 	// If Version Check parameters are specified
@@ -269,12 +357,12 @@ func computeState(appName string, state *AppState, useLatestVersion bool, apiKey
 		// Extract the targetVersion from the webpage
 		var err error
 		latestVersionFromRemote, err =
-			helper.GetVersion(url, state.Definition, apiKey, requestBody)
+			helper.GetVersion(ctx, url, state.Definition, apiKey, requestBody)
 		if err != nil {
-			log.Errorln("Error retrieving last version from remote", err)
+			logger.Errorln("Error retrieving last version from remote", err)
 		}
 	}
-	log.Debugln("Version from remote: ", latestVersionFromRemote)
+	logger.Debugln("Version from remote: ", latestVersionFromRemote)
 
 	var targetVersion *version.Version
 	if forcedVersion != nil {
@@ -291,14 +379,14 @@ func computeState(appName string, state *AppState, useLatestVersion bool, apiKey
 			if latestVersionFromRemote != nil && latestVersionFromRemote.IsNewerThan(configVersion) && latestVersionFromRemote.IsNewerThan(currentInstalledVersion) {
 				targetVersion = latestVersionFromRemote
 			} else if configVersion != nil && configVersion.IsNewerThan(currentInstalledVersion) {
-				log.Debugln("Config ", configVersion, " is newer than currentInstalled", currentInstalledVersion)
+				logger.Debugln("Config ", configVersion, " is newer than currentInstalled", currentInstalledVersion)
 				targetVersion = configVersion
 			} else {
 				targetVersion = currentInstalledVersion
 			}
 		}
 	}
-	log.Debugln("target version", targetVersion)
+	logger.Debugln("target version", targetVersion)
 	state.TargetVersion = targetVersion
 	state.computeStatus()
 }
@@ -316,6 +404,11 @@ func (state *AppState) StatusMessage() string {
 		return fmt.Sprint("upgrading version from ", state.CurrentVersion, " >> ", state.TargetVersion)
 	case DOWNGRADE:
 		return fmt.Sprint("downgrading version from ", state.CurrentVersion, " >> ", state.TargetVersion)
+	case UNINSTALL:
+		if state.CurrentVersion == nil {
+			return "not installed >> will clean remaining files (if any)"
+		}
+		return fmt.Sprint("uninstalling version ", state.CurrentVersion)
 	default:
 		return ""
 	}
@@ -334,11 +427,19 @@ func (state *AppState) SuccessMessage() string {
 		return fmt.Sprint("successfully upgraded from ", state.CurrentVersion, " to ", state.TargetVersion)
 	case DOWNGRADE:
 		return fmt.Sprint("successfully downgraded from ", state.CurrentVersion, " to ", state.TargetVersion)
+	case UNINSTALL:
+		return "successfully uninstalled"
 	default:
 		return ""
 	}
 }
 
+// SetTargetVersion forces target version (and updates status accordingly)
+func (state *AppState) SetTargetVersion(targetVersion *version.Version) {
+	state.TargetVersion = targetVersion
+	state.computeStatus()
+}
+
 func (state *AppState) computeStatus() {
 	if state.CurrentVersion == nil {
 		state.Status = INSTALL
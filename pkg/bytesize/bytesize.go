@@ -8,6 +8,9 @@ package bytesize
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
 type ByteSize float64
@@ -45,3 +48,40 @@ func (b ByteSize) String() string {
 	}
 	return fmt.Sprintf("%.2f B", b)
 }
+
+var units = map[string]ByteSize{
+	"":   1,
+	"B":  1,
+	"KB": KB,
+	"MB": MB,
+	"GB": GB,
+	"TB": TB,
+	"PB": PB,
+}
+
+// Parse reads a human size like "500MB", "1.5 GB" or "1024" (bytes)
+func Parse(text string) (ByteSize, error) {
+	cleaned := strings.ToUpper(strings.TrimSpace(text))
+	numberEnd := strings.IndexFunc(cleaned, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if numberEnd < 0 {
+		numberEnd = len(cleaned)
+	}
+
+	number, err := strconv.ParseFloat(cleaned[:numberEnd], 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad size %s | %w", text, err)
+	}
+
+	unitText := strings.TrimSuffix(strings.TrimSpace(cleaned[numberEnd:]), "IB")
+	if unitText != "" && !strings.HasSuffix(unitText, "B") {
+		unitText = unitText + "B" //allows 10G
+	}
+	unit, found := units[unitText]
+	if !found {
+		return 0, fmt.Errorf("bad size unit in %s", text)
+	}
+
+	return ByteSize(number) * unit, nil
+}
@@ -0,0 +1,31 @@
+package bytesize
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    ByteSize
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"500MB", 500 * MB, false},
+		{"1.5 GB", 1.5 * GB, false},
+		{"10g", 10 * GB, false},
+		{"2GiB", 2 * GB, false},
+		{"", 0, true},
+		{"12 apples", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := Parse(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Parse() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
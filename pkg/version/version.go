@@ -169,11 +169,21 @@ func (version Version) String() string {
 	return version.Text
 }
 
+// FillVersionsPlaceholders replaces {{VERSION}}, {{V_MAJOR}}... (see Placeholders) in input
 func (version Version) FillVersionsPlaceholders(input string) string {
 	if input == "" {
 		return input
 	}
 
+	for source, replacement := range version.Placeholders() {
+		input = strings.Replace(input, "{{"+source+"}}", replacement, -1)
+	}
+
+	return input
+}
+
+// Placeholders returns version parts by placeholder name (VERSION, V_MAJOR...), missing parts are empty
+func (version Version) Placeholders() map[string]string {
 	major := ""
 	if version.Major != nil {
 		major = fmt.Sprint(*version.Major)
@@ -194,7 +204,7 @@ func (version Version) FillVersionsPlaceholders(input string) string {
 		patch2 = fmt.Sprint(*version.Patch2)
 	}
 
-	var versionReplaces = map[string]string{
+	return map[string]string{
 		"VERSION":        fmt.Sprint(version),
 		"VERSION_NO_DOT": strings.ReplaceAll(version.String(), ".", ""),
 		"V_MAJOR":        major,
@@ -204,10 +214,4 @@ func (version Version) FillVersionsPlaceholders(input string) string {
 		"V_PRERELEASE":   version.Prerelease,
 		"V_BUILD":        version.Build,
 	}
-
-	for source, replacement := range versionReplaces {
-		input = strings.Replace(input, "{{"+source+"}}", replacement, -1)
-	}
-
-	return input
 }